@@ -0,0 +1,518 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errReadOnly is what writes inside an archive fail with
+var errReadOnly = errors.New("archive is read-only")
+
+// archiveEntry is a file, directory or symlink inside an archive.
+type archiveEntry struct {
+	mode    fs.FileMode
+	size    int64
+	packed  int64 // compressed size, 0 when the format has none
+	modTime time.Time
+	target  string // for symlinks
+	// the owner the archive records, tar only
+	uid, gid     int
+	owner, group string
+	// children holds the entries of a directory by name
+	children map[string]*archiveEntry
+	// open reads a file's contents
+	open func() (io.ReadCloser, error)
+	// stream is the tar a file is the index-th entry of, nil in other
+	// formats; many entries are read from it in one pass
+	stream *tarSource
+	index  int
+}
+
+func newArchiveDir(modTime time.Time) *archiveEntry {
+	return &archiveEntry{mode: fs.ModeDir | 0755, modTime: modTime, children: map[string]*archiveEntry{}}
+}
+
+// add puts e at name below the root dir d, making the directories on the
+// way that the archive does not list itself. Names leaving the archive,
+// like "../x", are dropped.
+func (d *archiveEntry) add(name string, e *archiveEntry) {
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return
+	}
+	dir := d
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := dir.children[part]
+		if !ok || !next.mode.IsDir() {
+			next = newArchiveDir(d.modTime)
+			dir.children[part] = next
+		}
+		dir = next
+	}
+	base := parts[len(parts)-1]
+	if old, ok := dir.children[base]; ok && old.mode.IsDir() && e.mode.IsDir() {
+		// a directory listed after its contents
+		old.mode, old.modTime = e.mode, e.modTime
+		return
+	}
+	if e.mode.IsDir() && e.children == nil {
+		e.children = map[string]*archiveEntry{}
+	}
+	dir.children[base] = e
+}
+
+// archiveFormat reads the tree of one kind of archive from the file at path
+// on fsys. The closer is kept until the archive is closed.
+type archiveFormat struct {
+	name     string
+	suffixes []string
+	read     func(fsys FS, path string) (*archiveEntry, io.Closer, error)
+}
+
+var archiveFormats = []archiveFormat{
+	{name: "zip", suffixes: []string{".zip", ".jar"}, read: readZip},
+	{name: "tar", suffixes: []string{".tar"}, read: tarReader(plainTar)},
+	{name: "tar.gz", suffixes: []string{".tar.gz", ".tgz"}, read: tarReader(gzipTar)},
+	{name: "tar.bz2", suffixes: []string{".tar.bz2", ".tbz2", ".tbz"}, read: tarReader(bzip2Tar)},
+}
+
+func archiveFormatOf(path string) *archiveFormat {
+	lower := strings.ToLower(path)
+	for i, f := range archiveFormats {
+		for _, suffix := range f.suffixes {
+			if strings.HasSuffix(lower, suffix) {
+				return &archiveFormats[i]
+			}
+		}
+	}
+	return nil
+}
+
+// isArchive reports whether path is an archive that can be browsed.
+func isArchive(path string) bool {
+	return archiveFormatOf(path) != nil
+}
+
+// archiveFS shows the archive file mount on outer as a read-only directory
+// at the same path. The archive is read on first use. Paths outside mount
+// are passed on to outer.
+type archiveFS struct {
+	outer  FS
+	mount  string
+	format *archiveFormat
+
+	once   sync.Once
+	root   *archiveEntry
+	closer io.Closer
+	err    error
+}
+
+func newArchiveFS(outer FS, mount string) *archiveFS {
+	return &archiveFS{outer: outer, mount: mount, format: archiveFormatOf(mount)}
+}
+
+// tree reads the archive the first time it is needed.
+func (a *archiveFS) tree() (*archiveEntry, error) {
+	a.once.Do(func() {
+		if a.format == nil {
+			a.err = errors.New("unknown archive format")
+			return
+		}
+		a.root, a.closer, a.err = a.format.read(a.outer, a.mount)
+	})
+	return a.root, a.err
+}
+
+func (a *archiveFS) Close() error {
+	// an archive never read has nothing open, and is not read after this
+	a.once.Do(func() { a.err = errors.New("archive closed") })
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func (a *archiveFS) inside(name string) bool {
+	return name == a.mount || strings.HasPrefix(name, a.mount+string(filepath.Separator))
+}
+
+// find returns the entry at name and its path with the links resolved,
+// following symlinks in its directories and, if follow is set, in name
+// itself. Links do not lead out of the archive.
+func (a *archiveFS) find(name string, follow bool, hops int) (*archiveEntry, string, error) {
+	root, err := a.tree()
+	if err != nil {
+		return nil, "", err
+	}
+	name = filepath.Clean(name)
+	if name == a.mount {
+		return root, name, nil
+	}
+	if !a.inside(name) {
+		return nil, "", fs.ErrNotExist
+	}
+	dir, dirPath, err := a.find(filepath.Dir(name), true, hops)
+	if err != nil {
+		return nil, "", err
+	}
+	e, ok := dir.children[filepath.Base(name)]
+	if !ok {
+		return nil, "", fs.ErrNotExist
+	}
+	path := filepath.Join(dirPath, filepath.Base(name))
+	if !follow || e.mode&fs.ModeSymlink == 0 {
+		return e, path, nil
+	}
+	if hops >= maxLinkHops {
+		return nil, "", errors.New("too many levels of symbolic links")
+	}
+	target := filepath.FromSlash(e.target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dirPath, target)
+	} else {
+		// absolute links point at the top of the archive
+		target = filepath.Join(a.mount, target)
+	}
+	return a.find(target, true, hops+1)
+}
+
+func (a *archiveFS) stat(op, name string, follow bool) (fs.FileInfo, error) {
+	if !a.inside(filepath.Clean(name)) {
+		if follow {
+			return a.outer.Stat(name)
+		}
+		return a.outer.Lstat(name)
+	}
+	e, _, err := a.find(name, follow, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return archiveInfo{name: filepath.Base(name), e: e}, nil
+}
+
+func (a *archiveFS) Lstat(name string) (fs.FileInfo, error) { return a.stat("lstat", name, false) }
+func (a *archiveFS) Stat(name string) (fs.FileInfo, error)  { return a.stat("stat", name, true) }
+
+func (a *archiveFS) Readlink(name string) (string, error) {
+	if !a.inside(filepath.Clean(name)) {
+		return a.outer.Readlink(name)
+	}
+	e, _, err := a.find(name, false, 0)
+	if err == nil && e.mode&fs.ModeSymlink == 0 {
+		err = errors.New("invalid argument")
+	}
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return e.target, nil
+}
+
+func (a *archiveFS) EvalSymlinks(name string) (string, error) {
+	if !a.inside(filepath.Clean(name)) {
+		return evalSymlinks(a.outer, name)
+	}
+	_, path, err := a.find(name, true, 0)
+	if err != nil {
+		return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: err}
+	}
+	return path, nil
+}
+
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	if !a.inside(filepath.Clean(name)) {
+		return a.outer.Open(name)
+	}
+	e, _, err := a.find(name, true, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := archiveInfo{name: filepath.Base(name), e: e}
+	if !e.mode.IsDir() {
+		if e.open == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("unsupported entry")}
+		}
+		rc, err := e.open()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &archiveFile{ReadCloser: rc, info: info}, nil
+	}
+
+	names := make([]string, 0, len(e.children))
+	for child := range e.children {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		entries[i] = fs.FileInfoToDirEntry(archiveInfo{name: child, e: e.children[child]})
+	}
+	return &archiveDir{info: info, entries: entries}, nil
+}
+
+func (a *archiveFS) Create(name string) (io.WriteCloser, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: errReadOnly}
+}
+
+func (a *archiveFS) Mkdir(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: errReadOnly}
+}
+
+func (a *archiveFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+func (a *archiveFS) Rename(oldname, newname string) error {
+	return &fs.PathError{Op: "rename", Path: oldname, Err: errReadOnly}
+}
+
+// archiveInfo describes an archiveEntry. Sys returns the entry.
+type archiveInfo struct {
+	name string
+	e    *archiveEntry
+}
+
+func (i archiveInfo) Name() string       { return i.name }
+func (i archiveInfo) Size() int64        { return i.e.size }
+func (i archiveInfo) Mode() fs.FileMode  { return i.e.mode }
+func (i archiveInfo) ModTime() time.Time { return i.e.modTime }
+func (i archiveInfo) IsDir() bool        { return i.e.mode.IsDir() }
+func (i archiveInfo) Sys() any           { return i.e }
+
+// fillArchiveMetadata adds what only archives know to m.
+func fillArchiveMetadata(m *NodeMetadata, info fs.FileInfo) {
+	if e, ok := info.Sys().(*archiveEntry); ok {
+		m.PackedSize = e.packed
+		m.Uid, m.Gid = uint32(e.uid), uint32(e.gid)
+		if e.owner != "" || e.group != "" {
+			m.ArchiveOwner = e.owner + ":" + e.group
+		}
+	}
+}
+
+type archiveFile struct {
+	io.ReadCloser
+	info archiveInfo
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type archiveDir struct {
+	info    archiveInfo
+	entries []fs.DirEntry
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *archiveDir) Close() error               { return nil }
+func (d *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// inArchive reports whether n is inside an archive.
+func inArchive(n *Node) bool {
+	_, ok := n.FS().(*archiveFS)
+	return ok
+}
+
+// OpenArchive returns the directory showing the contents of the archive
+// file n. It is made once per node, and the archive is read when the
+// directory is first loaded.
+func (e *Engine) OpenArchive(n *Node) (*Node, error) {
+	if n.metadata.IsDir || !isArchive(n.metadata.Path) {
+		return nil, errors.New("not an archive")
+	}
+	n.mu.Lock()
+	root := n.mounted
+	created := root == nil
+	if created {
+		afs := newArchiveFS(n.FS(), n.metadata.Path)
+		meta := *n.metadata
+		meta.IsDir = true
+		meta.Mode = fs.ModeDir | meta.Mode.Perm()
+		root = &Node{parent: n.parent, cache: n.cache, fsys: afs, children: []*Node{}, metadata: &meta}
+		n.mounted = root
+	}
+	n.mu.Unlock()
+
+	if created {
+		e.mu.Lock()
+		e.archives = append(e.archives, root.fsys.(*archiveFS))
+		e.mu.Unlock()
+	}
+	return root, nil
+}
+
+// Extract copies n, a file or directory inside an archive, next to the
+// archive on the filesystem it lives on, and returns the path it was
+// written to. Nothing existing is overwritten.
+func (e *Engine) Extract(n *Node) (string, error) {
+	if !inArchive(n) {
+		return "", errors.New("not inside an archive")
+	}
+	home := n.Parent()
+	for home != nil && inArchive(home) {
+		home = home.Parent()
+	}
+	if home == nil {
+		return "", errors.New("no directory to extract to")
+	}
+	dest := filepath.Join(home.metadata.Path, filepath.Base(n.metadata.Path))
+	if _, err := home.FS().Lstat(dest); err == nil {
+		return "", &fs.PathError{Op: "extract", Path: dest, Err: fs.ErrExist}
+	}
+
+	err := extractTree(n.FS(), n.metadata.Path, home.FS(), dest)
+	if home.Loaded() {
+		patchChild(home, filepath.Base(dest))
+	}
+	invalidateUsage(home)
+	return dest, err
+}
+
+// Symlinker is implemented by filesystems that can make symlinks.
+type Symlinker interface {
+	Symlink(oldname, newname string) error
+}
+
+// extractTree is copyTree out of an archive. Opening a tar entry reads
+// the stream up to it, so files from a tar are only noted while the tree
+// is laid out and then written in one pass over each stream.
+func extractTree(from FS, src string, to FS, dst string) error {
+	a, ok := from.(*archiveFS)
+	if !ok {
+		return copyTree(from, src, to, dst)
+	}
+	pending := map[*tarSource]map[int][]string{}
+	err := copyTreeWith(from, src, to, dst, func(src, dst string) error {
+		e, _, err := a.find(src, true, 0)
+		if err != nil || e.stream == nil {
+			return copyFile(from, src, to, dst)
+		}
+		if pending[e.stream] == nil {
+			pending[e.stream] = map[int][]string{}
+		}
+		pending[e.stream][e.index] = append(pending[e.stream][e.index], dst)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for stream, files := range pending {
+		err := stream.each(files, func(index int, r io.Reader) error {
+			var ws []io.Writer
+			var closers []io.WriteCloser
+			for _, dst := range files[index] {
+				w, err := to.Create(dst)
+				if err != nil {
+					for _, c := range closers {
+						c.Close()
+					}
+					return err
+				}
+				ws = append(ws, w)
+				closers = append(closers, w)
+			}
+			_, err := io.Copy(io.MultiWriter(ws...), r)
+			for _, c := range closers {
+				if cerr := c.Close(); err == nil {
+					err = cerr
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the file, directory or symlink at src on from to dst on
+// to. Symlinks are skipped where to cannot make them.
+func copyTree(from FS, src string, to FS, dst string) error {
+	return copyTreeWith(from, src, to, dst, func(src, dst string) error {
+		return copyFile(from, src, to, dst)
+	})
+}
+
+// copyTreeWith is copyTree with the files copied by copyFile.
+func copyTreeWith(from FS, src string, to FS, dst string, copyFile func(src, dst string) error) error {
+	info, err := from.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := from.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if s, ok := to.(Symlinker); ok {
+			return s.Symlink(target, dst)
+		}
+		return nil
+	case info.IsDir():
+		if err := to.Mkdir(dst, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := readDir(from, src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyTreeWith(from, filepath.Join(src, entry.Name()), to, filepath.Join(dst, entry.Name()), copyFile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile copies the contents of the file src on from to dst on to.
+func copyFile(from FS, src string, to FS, dst string) error {
+	r, err := from.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := to.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
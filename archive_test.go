@@ -0,0 +1,289 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeZip stores a zip with the given files in fsys at path. Names ending
+// in a slash are directories.
+func writeZip(t *testing.T, fsys *MemFS, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZipArchive_Browse(t *testing.T) {
+	fsys, root := makeMemTree(t)
+	readme := strings.Repeat("read me ", 100)
+	writeZip(t, fsys, filepath.Join(root, "a.zip"), map[string]string{
+		"docs/readme.txt": readme,
+		"bin/tool":        "x",
+		"empty/":          "",
+		"../escape":       "no",
+	})
+	engine := newMemEngine(t, fsys, root)
+	defer engine.Close()
+
+	zipNode := nodeAt(engine.current, "a.zip")
+	dir, err := engine.OpenArchive(zipNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := engine.OpenArchive(zipNode); again != dir {
+		t.Error("the archive should be opened once")
+	}
+	if err := engine.Load(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(dir.Children()); got != "bin docs empty" {
+		t.Fatalf("archive children = %q", got)
+	}
+
+	engine.ChangeDirectory(dir)
+	// bin, docs, empty
+	if err := engine.Enter(1); err != nil {
+		t.Fatal(err)
+	}
+	file := engine.current.Children()[0]
+	if file.metadata.Size != int64(len(readme)) || file.metadata.PackedSize <= 0 || file.metadata.PackedSize >= file.metadata.Size {
+		t.Errorf("readme size %d, packed %d", file.metadata.Size, file.metadata.PackedSize)
+	}
+	f, err := file.FS().Open(file.metadata.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != readme {
+		t.Errorf("read %d bytes of readme", len(data))
+	}
+
+	if err := engine.Delete(file); !errors.Is(err, errReadOnly) {
+		t.Errorf("delete inside an archive: %v", err)
+	}
+
+	// going up twice leaves the archive
+	engine.Up()
+	engine.Up()
+	if engine.current.metadata.Path != root || inArchive(engine.current) {
+		t.Errorf("after going up, current = %s", engine.current.metadata.Path)
+	}
+}
+
+func TestZipArchive_Extract(t *testing.T) {
+	fsys, root := makeMemTree(t, "sub/keep")
+	writeZip(t, fsys, filepath.Join(root, "sub", "a.zip"), map[string]string{
+		"docs/readme.txt": "hello",
+		"docs/more/x":     "x",
+	})
+	engine := newMemEngine(t, fsys, root)
+	sub := nodeAt(engine.current, "sub")
+	dir, _ := engine.OpenArchive(nodeAt(sub, "a.zip"))
+
+	docs := nodeAt(dir, "docs")
+	path, err := engine.Extract(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(root, "sub", "docs") {
+		t.Errorf("extracted to %s", path)
+	}
+	f, err := fsys.Open(filepath.Join(path, "readme.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "hello" {
+		t.Errorf("extracted readme = %q", data)
+	}
+	if _, err := fsys.Stat(filepath.Join(path, "more", "x")); err != nil {
+		t.Errorf("nested file not extracted: %v", err)
+	}
+	if nodeAt(sub, "docs") == nil {
+		t.Error("the extracted directory is not in the tree")
+	}
+
+	if _, err := engine.Extract(docs); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("extracting twice: %v", err)
+	}
+	if _, err := engine.Extract(sub); err == nil {
+		t.Error("extracting outside an archive should fail")
+	}
+}
+
+// countingFS counts how often archive files are opened.
+type countingFS struct {
+	*MemFS
+	opens int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	if isArchive(name) {
+		c.opens++
+	}
+	return c.MemFS.Open(name)
+}
+
+func writeTarGz(t *testing.T, fsys *MemFS, path string, headers []*tar.Header, contents map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range headers {
+		data := contents[hdr.Name]
+		hdr.Size = int64(len(data))
+		if hdr.ModTime.IsZero() {
+			hdr.ModTime = time.Unix(1700000000, 0)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	if err := fsys.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarArchive_Browse(t *testing.T) {
+	mem, root := makeMemTree(t)
+	writeTarGz(t, mem, filepath.Join(root, "a.tar.gz"), []*tar.Header{
+		{Name: "src/", Typeflag: tar.TypeDir, Mode: 0750, Uname: "ann", Gname: "dev", Uid: 1000, Gid: 100},
+		{Name: "src/main.go", Typeflag: tar.TypeReg, Mode: 0644, Uname: "ann", Gname: "dev", Uid: 1000, Gid: 100},
+		{Name: "src/run.sh", Typeflag: tar.TypeReg, Mode: 0755, Uname: "bob", Gname: "dev"},
+		{Name: "src/current", Typeflag: tar.TypeSymlink, Linkname: "main.go", Mode: 0777},
+		{Name: "src/copy.go", Typeflag: tar.TypeLink, Linkname: "src/main.go"},
+	}, map[string]string{
+		"src/main.go": "package main\n",
+		"src/run.sh":  "#!/bin/sh\n",
+	})
+	fsys := &countingFS{MemFS: mem}
+	engine := newMemEngine(t, fsys, root)
+
+	dir, err := engine.OpenArchive(nodeAt(engine.current, "a.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := nodeAt(dir, "src")
+	if src == nil || src.metadata.Mode != fs.ModeDir|0750 {
+		t.Fatalf("src = %+v", src)
+	}
+	if got := names(src.Children()); got != "copy.go current main.go run.sh" {
+		t.Fatalf("src children = %q", got)
+	}
+
+	main := nodeAt(src, "main.go")
+	if main.metadata.Mode != 0644 || main.metadata.ArchiveOwner != "ann:dev" || main.metadata.Uid != 1000 {
+		t.Errorf("main.go metadata = %+v", main.metadata)
+	}
+	link := nodeAt(src, "current")
+	if !link.metadata.IsSymlink || link.metadata.LinkTarget != "main.go" || link.metadata.BrokenLink {
+		t.Errorf("current metadata = %+v", link.metadata)
+	}
+	opened := fsys.opens
+
+	read := func(n *Node) string {
+		f, err := n.FS().Open(n.metadata.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		return string(data)
+	}
+	if got := read(nodeAt(src, "run.sh")); got != "#!/bin/sh\n" {
+		t.Errorf("run.sh = %q", got)
+	}
+	if got := read(nodeAt(src, "copy.go")); got != "package main\n" {
+		t.Errorf("hard link copy.go = %q", got)
+	}
+
+	// moving around again uses the tree read the first time
+	fsys.opens = opened
+	engine.ChangeDirectory(src)
+	engine.Up()
+	engine.current.Children()
+	nodeAt(dir, "src").Children()
+	if fsys.opens != opened {
+		t.Errorf("the archive was read %d more times", fsys.opens-opened)
+	}
+
+	props, err := loadProperties(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Owner != "ann" || props.Group != "dev" || props.FSType != "tar.gz" {
+		t.Errorf("properties = %+v", props)
+	}
+}
+
+func TestTarArchive_ExtractReadsOnce(t *testing.T) {
+	mem, root := makeMemTree(t)
+	writeTarGz(t, mem, filepath.Join(root, "a.tar.gz"), []*tar.Header{
+		{Name: "pkg/a.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "pkg/deep/b.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "pkg/c.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "pkg/same.txt", Typeflag: tar.TypeLink, Linkname: "pkg/a.txt"},
+		{Name: "pkg/current", Typeflag: tar.TypeSymlink, Linkname: "c.txt", Mode: 0777},
+	}, map[string]string{
+		"pkg/a.txt":      "a",
+		"pkg/deep/b.txt": "b",
+		"pkg/c.txt":      "c",
+	})
+	fsys := &countingFS{MemFS: mem}
+	engine := newMemEngine(t, fsys, root)
+	dir, err := engine.OpenArchive(nodeAt(engine.current, "a.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := nodeAt(dir, "pkg")
+	opened := fsys.opens
+
+	path, err := engine.Extract(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsys.opens != opened+1 {
+		t.Errorf("extracting read the archive %d times, want once", fsys.opens-opened)
+	}
+	for name, want := range map[string]string{"a.txt": "a", "deep/b.txt": "b", "c.txt": "c", "same.txt": "a", "current": "c"} {
+		f, err := mem.Open(filepath.Join(path, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Bookmarks maps single-key marks to directory paths. They live in a JSON
+// object of mark to path, which is fine to edit by hand.
+type Bookmarks struct {
+	mu    sync.Mutex
+	path  string
+	marks map[string]string
+}
+
+// Bookmark is one mark and the path it points at.
+type Bookmark struct {
+	Key  string
+	Path string
+}
+
+func DefaultBookmarksPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "bookmarks.json"), nil
+}
+
+// OpenBookmarks loads the marks stored at path. A missing or broken file
+// gives no marks; an empty path keeps them in memory only.
+func OpenBookmarks(path string) *Bookmarks {
+	b := &Bookmarks{path: path, marks: map[string]string{}}
+	b.Reload()
+	return b
+}
+
+// Reload reads the file again, to pick up edits made by hand. Marks that
+// are not a single character are left out.
+func (b *Bookmarks) Reload() {
+	if b.path == "" {
+		return
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return
+	}
+	var marks map[string]string
+	if json.Unmarshal(data, &marks) != nil || marks == nil {
+		return
+	}
+	for key := range marks {
+		if utf8.RuneCountInString(key) != 1 {
+			delete(marks, key)
+		}
+	}
+	b.mu.Lock()
+	b.marks = marks
+	b.mu.Unlock()
+}
+
+// Get returns the path marked with key.
+func (b *Bookmarks) Get(key string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	path, ok := b.marks[key]
+	return path, ok
+}
+
+// List returns the marks ordered by key.
+func (b *Bookmarks) List() []Bookmark {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := make([]Bookmark, 0, len(b.marks))
+	for key, path := range b.marks {
+		list = append(list, Bookmark{Key: key, Path: path})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Set marks path with key, replacing what key marked before, and saves
+// the file.
+func (b *Bookmarks) Set(key, path string) error {
+	b.mu.Lock()
+	b.marks[key] = path
+	b.mu.Unlock()
+	return b.save()
+}
+
+// Delete removes the mark key and saves the file.
+func (b *Bookmarks) Delete(key string) error {
+	b.mu.Lock()
+	delete(b.marks, key)
+	b.mu.Unlock()
+	return b.save()
+}
+
+// markPath turns a stored location into a path to resolve on share, or on
+// the local disk when share is nil. ok is false for a location elsewhere.
+func markPath(share *davFS, location string) (path string, ok bool) {
+	if !isRemote(location) {
+		return location, share == nil
+	}
+	if share == nil {
+		return "", false
+	}
+	rest, found := strings.CutPrefix(location, share.String())
+	if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", false
+	}
+	return filepath.FromSlash("/" + strings.TrimPrefix(rest, "/")), true
+}
+
+func (b *Bookmarks) save() error {
+	b.mu.Lock()
+	data, err := json.MarshalIndent(b.marks, "", "  ")
+	b.mu.Unlock()
+	if err != nil || b.path == "" {
+		return err
+	}
+	return writeFileAtomic(b.path, append(data, '\n'))
+}
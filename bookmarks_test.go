@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBookmarks_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	b := OpenBookmarks(path)
+	if err := b.Set("p", "/home/me/projects"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("d", "/home/me/Downloads"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := OpenBookmarks(path)
+	if got, ok := reopened.Get("p"); !ok || got != "/home/me/projects" {
+		t.Errorf("Get(p) = %q, %v after reopening", got, ok)
+	}
+	list := reopened.List()
+	if len(list) != 2 || list[0].Key != "d" || list[1].Key != "p" {
+		t.Errorf("List() = %v, want d then p", list)
+	}
+
+	if err := reopened.Delete("p"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := OpenBookmarks(path).Get("p"); ok {
+		t.Error("deleted mark came back after reopening")
+	}
+}
+
+func TestBookmarks_ReloadHandEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	b := OpenBookmarks(path)
+	if err := b.Set("a", "/a"); err != nil {
+		t.Fatal(err)
+	}
+	edited := `{"a": "/a", "w": "/work", "long": "/ignored"}`
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b.Reload()
+	if got, _ := b.Get("w"); got != "/work" {
+		t.Errorf("Get(w) = %q after reload, want /work", got)
+	}
+	if _, ok := b.Get("long"); ok {
+		t.Error("a mark longer than one key was loaded")
+	}
+}
+
+func TestBookmarks_BrokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := OpenBookmarks(path)
+	if len(b.List()) != 0 {
+		t.Errorf("List() = %v from a broken file", b.List())
+	}
+	if err := b.Set("x", "/x"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := OpenBookmarks(path).Get("x"); got != "/x" {
+		t.Errorf("Get(x) = %q, want the broken file replaced", got)
+	}
+}
+
+func TestBookmarks_NullFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.json")
+	b := OpenBookmarks(path)
+	if err := os.WriteFile(path, []byte("null"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b.Reload()
+	if err := b.Set("n", "/n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Get("n"); got != "/n" {
+		t.Errorf("Get(n) = %q after a null file, want /n", got)
+	}
+}
+
+func TestBookmarks_RemoteLocations(t *testing.T) {
+	_, location := startDAV(t, "docs/a.txt")
+	engine, err := OpenEngine(strings.Replace(location, "webdav://", "webdav://ann:secret@", 1)+"/tree", &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := shareOf(engine.current.FS())
+	docs := nodeAt(engine.current, "docs")
+
+	mark := nodeLocation(docs)
+	if mark != location+"/tree/docs" {
+		t.Fatalf("nodeLocation = %q, want %q", mark, location+"/tree/docs")
+	}
+	if path, ok := markPath(share, mark); !ok || path != filepath.Join("/tree", "docs") {
+		t.Errorf("markPath on the share = %q, %v", path, ok)
+	}
+	if _, ok := markPath(nil, mark); ok {
+		t.Error("a share mark resolved on the local disk")
+	}
+	if _, ok := markPath(share, "/home/me"); ok {
+		t.Error("a local mark resolved on the share")
+	}
+	if _, ok := markPath(share, location+"0/tree"); ok {
+		t.Error("a mark on another port resolved on the share")
+	}
+	if path, ok := markPath(nil, "/home/me"); !ok || path != "/home/me" {
+		t.Errorf("markPath locally = %q, %v", path, ok)
+	}
+}
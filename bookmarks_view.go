@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// bookmarksModel is the list of bookmarks.
+type bookmarksModel struct {
+	list list.Model
+	err  error
+}
+
+type bookmarkItem struct {
+	mark Bookmark
+}
+
+func (i bookmarkItem) Title() string       { return fmt.Sprintf("%s  %s", i.mark.Key, i.mark.Path) }
+func (i bookmarkItem) Description() string { return "press ' " + i.mark.Key + " to jump here" }
+func (i bookmarkItem) FilterValue() string { return i.mark.Key + " " + i.mark.Path }
+
+// markPending says what the next key press in the file view is for: a new
+// mark or a mark to jump to.
+type markPending int
+
+const (
+	noMark markPending = iota
+	setMark
+	jumpMark
+)
+
+// openBookmarks shows the bookmarks view, with the file reloaded in case
+// it was edited.
+func (m *model) openBookmarks() tea.Cmd {
+	m.bookmarks.Reload()
+	m.marks.err = nil
+	m.views.Push(m.currentView)
+	m.currentView = bookmarksView
+	return m.refreshBookmarks()
+}
+
+func (m *model) refreshBookmarks() tea.Cmd {
+	var items []list.Item
+	for _, b := range m.bookmarks.List() {
+		items = append(items, bookmarkItem{mark: b})
+	}
+	return m.marks.list.SetItems(items)
+}
+
+// handleMark finishes a mark or jump started in the file view with key.
+func (m *model) handleMark(key string) tea.Cmd {
+	pending := m.file.pendingMark
+	m.file.pendingMark = noMark
+	m.file.notice = ""
+	if len([]rune(key)) != 1 {
+		return nil
+	}
+	switch pending {
+	case setMark:
+		path := nodeLocation(m.engine.current)
+		if err := m.bookmarks.Set(key, path); err != nil {
+			m.file.notice = "saving bookmark: " + err.Error()
+		} else {
+			m.file.notice = fmt.Sprintf("marked %s as %s", path, key)
+		}
+	case jumpMark:
+		return m.jumpToMark(key)
+	}
+	return nil
+}
+
+// jumpToMark opens the directory marked with key.
+func (m *model) jumpToMark(key string) tea.Cmd {
+	location, ok := m.bookmarks.Get(key)
+	if !ok {
+		m.file.notice = "no bookmark " + key
+		return nil
+	}
+	path, ok := markPath(shareOf(m.engine.current.FS()), location)
+	if !ok {
+		m.file.notice = fmt.Sprintf("%s is not on what you are browsing, start %s there", location, appName)
+		return nil
+	}
+	engine := m.engine
+	return func() tea.Msg {
+		n, err := engine.Resolve(path)
+		return jumpedMsg{node: n, err: err}
+	}
+}
+
+func (m *model) updateBookmarksView(msg tea.Msg) tea.Cmd {
+	if msg, ok := msg.(tea.KeyMsg); ok && m.marks.list.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "esc", "q":
+			if view, ok := m.views.Pop(); ok {
+				m.currentView = view
+			}
+			return nil
+		case "enter":
+			if it, ok := m.marks.list.SelectedItem().(bookmarkItem); ok {
+				if view, ok := m.views.Pop(); ok {
+					m.currentView = view
+				}
+				return m.jumpToMark(it.mark.Key)
+			}
+			return nil
+		case "d", "delete":
+			if it, ok := m.marks.list.SelectedItem().(bookmarkItem); ok {
+				m.marks.err = m.bookmarks.Delete(it.mark.Key)
+				return m.refreshBookmarks()
+			}
+			return nil
+		}
+	}
+	var cmd tea.Cmd
+	m.marks.list, cmd = m.marks.list.Update(msg)
+	return cmd
+}
+
+func (m model) renderBookmarksView() string {
+	footer := titleAccentStyle.Render("enter") + titleMutedStyle.Render(" jump  ") +
+		titleAccentStyle.Render("d") + titleMutedStyle.Render(" delete  ") +
+		titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back")
+	if m.marks.err != nil {
+		footer = highPriorityStyle.Render("✗ " + m.marks.err.Error())
+	}
+	body := m.marks.list.View()
+	if len(m.marks.list.Items()) == 0 {
+		body = titleMutedStyle.Render("No bookmarks yet. Press m and a key in the file view to mark a directory.")
+	}
+	return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, body, footer))
+}
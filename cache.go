@@ -0,0 +1,201 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheBudget is how many nodes the tree keeps loaded by default.
+// A node costs a few hundred bytes, so this is in the tens of megabytes.
+const DefaultCacheBudget = 200000
+
+// NodeCache bounds the memory the Node tree uses. It tracks loaded
+// directories by last use and, once their children add up to more nodes than
+// the budget, unloads the least recently used ones. Unloaded directories
+// are read again on their next visit. The current directory and its
+// ancestors are never unloaded.
+type NodeCache struct {
+	mu sync.Mutex
+
+	budget  int
+	size    int
+	order   *list.List // front is most recently used
+	entries map[*Node]*list.Element
+	pinned  *Node
+
+	// onUnload is told about every directory that was unloaded
+	onUnload func(*Node)
+
+	hits, misses, evictions int64
+}
+
+type cacheEntry struct {
+	node  *Node
+	count int
+}
+
+// CacheStats is a snapshot of the cache counters for debugging.
+type CacheStats struct {
+	Budget    int
+	Nodes     int
+	Dirs      int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+func NewNodeCache(budget int) *NodeCache {
+	if budget <= 0 {
+		budget = DefaultCacheBudget
+	}
+	return &NodeCache{
+		budget:  budget,
+		order:   list.New(),
+		entries: map[*Node]*list.Element{},
+	}
+}
+
+func (c *NodeCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Budget:    c.budget,
+		Nodes:     c.size,
+		Dirs:      len(c.entries),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// SetBudget changes the budget, unloading directories right away if the
+// tree is now too big.
+func (c *NodeCache) SetBudget(budget int) {
+	if budget <= 0 {
+		budget = DefaultCacheBudget
+	}
+	c.mu.Lock()
+	c.budget = budget
+	victims := c.victims()
+	c.mu.Unlock()
+	c.unloadAll(victims)
+}
+
+// pin protects n and its ancestors from eviction.
+func (c *NodeCache) pin(n *Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned = n
+	c.touchLocked(n)
+}
+
+func (c *NodeCache) setOnUnload(fn func(*Node)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onUnload = fn
+}
+
+// hit records a use of the already loaded directory n.
+func (c *NodeCache) hit(n *Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits++
+	c.touchLocked(n)
+}
+
+// miss records that n was just loaded with count children, and unloads
+// other directories if that took the tree over budget.
+func (c *NodeCache) miss(n *Node, count int) {
+	c.mu.Lock()
+	c.misses++
+	if el, ok := c.entries[n]; ok {
+		c.size -= el.Value.(*cacheEntry).count
+		c.order.Remove(el)
+	}
+	c.entries[n] = c.order.PushFront(&cacheEntry{node: n, count: count})
+	c.size += count
+	victims := c.victims()
+	c.mu.Unlock()
+
+	// unloading takes node locks, which must not be taken under c.mu
+	c.unloadAll(victims)
+}
+
+func (c *NodeCache) touchLocked(n *Node) {
+	if el, ok := c.entries[n]; ok {
+		c.order.MoveToFront(el)
+	}
+}
+
+// victims picks least recently used directories until the tree fits the
+// budget again and removes them from the cache. The most recently used
+// directory stays, it was loaded because someone is about to look at it.
+func (c *NodeCache) victims() []*Node {
+	var victims []*Node
+	for el := c.order.Back(); el != nil && el != c.order.Front() && c.size > c.budget; {
+		prev := el.Prev()
+		entry := el.Value.(*cacheEntry)
+		if !c.isPinned(entry.node) {
+			c.order.Remove(el)
+			delete(c.entries, entry.node)
+			c.size -= entry.count
+			c.evictions++
+			victims = append(victims, entry.node)
+		}
+		el = prev
+	}
+	return victims
+}
+
+// isPinned reports whether n is the pinned node or one of its ancestors.
+// The caller holds c.mu, which Engine.Parent holds too when it sets a
+// parent, so the parents can be read without the node locks.
+func (c *NodeCache) isPinned(n *Node) bool {
+	for p := c.pinned; p != nil; p = p.parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *NodeCache) unloadAll(victims []*Node) {
+	for _, n := range victims {
+		c.unload(n)
+	}
+}
+
+// unload drops the children of n, and everything loaded below them, so
+// they are read from disk again on the next visit.
+func (c *NodeCache) unload(n *Node) {
+	n.mu.Lock()
+	children := n.children
+	n.children = []*Node{}
+	n.loaded = false
+	n.err = nil
+	n.mu.Unlock()
+
+	c.mu.Lock()
+	onUnload := c.onUnload
+	c.mu.Unlock()
+	if onUnload != nil {
+		onUnload(n)
+	}
+
+	for _, child := range children {
+		child.mu.Lock()
+		loaded := child.loaded
+		child.mu.Unlock()
+		if !loaded {
+			continue
+		}
+		c.mu.Lock()
+		if el, ok := c.entries[child]; ok {
+			c.size -= el.Value.(*cacheEntry).count
+			c.order.Remove(el)
+			delete(c.entries, child)
+		}
+		c.mu.Unlock()
+		c.unload(child)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNodeCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	fsys, root := makeMemTree(t, "a/1", "a/2", "b/1", "b/2", "c/1", "c/2")
+	engine := newMemEngine(t, fsys, root)
+	// root holds 3 children, each subdirectory 2 more
+	engine.SetCacheBudget(7)
+
+	dirs := engine.current.Children()
+	a, b, c := dirs[0], dirs[1], dirs[2]
+
+	a.Children()
+	b.Children()
+	if !a.Loaded() || !b.Loaded() {
+		t.Fatal("a and b should fit in the budget")
+	}
+
+	c.Children()
+	if a.Loaded() {
+		t.Error("a is the least recently used directory and should be unloaded")
+	}
+	if !b.Loaded() || !c.Loaded() {
+		t.Error("b and c should still be loaded")
+	}
+	if !engine.current.Loaded() {
+		t.Error("the current directory must never be unloaded")
+	}
+
+	// an unloaded directory simply loads again
+	if got := len(a.Children()); got != 2 {
+		t.Errorf("reloaded a has %d children, want 2", got)
+	}
+
+	st := engine.CacheStats()
+	if st.Evictions < 2 || st.Misses < 5 || st.Nodes > st.Budget {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestNodeCache_KeepsCurrentPathLoaded(t *testing.T) {
+	fsys, root := makeMemTree(t, "deep/er/x", "other/y", "other/z")
+	engine := newMemEngine(t, fsys, root)
+	engine.SetCacheBudget(1)
+
+	deep := engine.current.Children()[0]
+	deep.Children()
+	engine.ChangeDirectory(deep)
+	er := deep.Children()[0]
+	er.Children()
+	engine.ChangeDirectory(er)
+
+	engine.current.parent.parent.Children()[1].Children()
+
+	for n := er; n != nil; n = n.parent {
+		if !n.Loaded() {
+			t.Errorf("%s on the current path was unloaded", n.metadata.Path)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// appName names the directories we keep config and cache files in
+const appName = "filedhundho"
+
+// Config is read from config.json under $XDG_CONFIG_HOME/filedhundho.
+// Every field is optional; a missing file gives the defaults.
+type Config struct {
+	// IndexRoots are the directories the filename index covers. Defaults to
+	// the home directory.
+	IndexRoots []string `json:"index_roots,omitempty"`
+
+	// CacheNodes is how many nodes the directory tree keeps in memory
+	// before unloading the least recently used directories.
+	CacheNodes int `json:"cache_nodes,omitempty"`
+
+	// FollowSymlinks lets enter open symlinked directories. When false they
+	// are only shown as links. Defaults to true.
+	FollowSymlinks *bool `json:"follow_symlinks,omitempty"`
+
+	// ShowHidden and ShowIgnored start the file list with dotfiles and
+	// .gitignore matches visible.
+	ShowHidden  bool `json:"show_hidden,omitempty"`
+	ShowIgnored bool `json:"show_ignored,omitempty"`
+	// Exclude lists name globs hidden from the file list. Defaults to
+	// defaultExclude, an empty list hides nothing.
+	Exclude []string `json:"exclude"`
+
+	// WebDAV holds logins for webdav:// shares by host, like
+	// "files.example.com:8080".
+	WebDAV map[string]WebDAVAuth `json:"webdav,omitempty"`
+}
+
+var defaultExclude = []string{"node_modules", "__pycache__"}
+
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "config.json"), nil
+}
+
+// LoadConfig reads the config file at path. A missing file is not an error.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg.applyDefaults()
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+func (c *Config) applyDefaults() {
+	if c.CacheNodes <= 0 {
+		c.CacheNodes = DefaultCacheBudget
+	}
+	if c.FollowSymlinks == nil {
+		follow := true
+		c.FollowSymlinks = &follow
+	}
+	if c.Exclude == nil {
+		c.Exclude = defaultExclude
+	}
+	if len(c.IndexRoots) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			c.IndexRoots = []string{home}
+		}
+	}
+	for i, root := range c.IndexRoots {
+		c.IndexRoots[i] = expandPath(root)
+	}
+}
+
+// expandPath resolves a leading ~ and environment variables in path.
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || len(path) > 1 && path[0] == '~' && os.IsPathSeparator(path[1]) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fileDelegate is the default delegate with entries that could not be read,
+// and broken links, drawn in red and other symlinks in cyan.
+type fileDelegate struct {
+	list.DefaultDelegate
+}
+
+func newFileDelegate() fileDelegate {
+	return fileDelegate{DefaultDelegate: list.NewDefaultDelegate()}
+}
+
+func (d fileDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	// d is a copy, so the style changes only last for this item
+	if it, ok := listItem.(item); ok {
+		switch {
+		case it.node.Err() != nil || it.node.metadata.BrokenLink:
+			d.colorize(colorRed)
+		case it.node.metadata.IsSymlink:
+			d.colorize(colorCyan)
+		}
+	}
+	d.DefaultDelegate.Render(w, m, index, listItem)
+}
+
+func (d *fileDelegate) colorize(c lipgloss.Color) {
+	d.Styles.NormalTitle = d.Styles.NormalTitle.Foreground(c)
+	d.Styles.NormalDesc = d.Styles.NormalDesc.Foreground(c)
+	d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(c).BorderForeground(c)
+	d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(c).BorderForeground(c)
+}
+
+// searchDelegate renders search hits like the default delegate, but
+// highlights the characters that matched the query, fzf style. Content
+// search hits get the match highlighted in their snippet line.
+type searchDelegate struct {
+	list.DefaultDelegate
+}
+
+func newSearchDelegate() searchDelegate {
+	return searchDelegate{DefaultDelegate: list.NewDefaultDelegate()}
+}
+
+func (d searchDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	it, ok := listItem.(searchItem)
+	if !ok || len(it.matches)+len(it.descMatches) == 0 || m.FilterState() != list.Unfiltered {
+		d.DefaultDelegate.Render(w, m, index, listItem)
+		return
+	}
+	if m.Width() <= 0 {
+		return
+	}
+
+	s := &d.Styles
+	titleStyle, descStyle := s.NormalTitle, s.NormalDesc
+	if index == m.Index() {
+		titleStyle, descStyle = s.SelectedTitle, s.SelectedDesc
+	}
+
+	width := m.Width() - s.NormalTitle.GetPaddingLeft() - s.NormalTitle.GetPaddingRight()
+	title := truncateRunes(it.Title(), width)
+	desc := truncateRunes(it.Description(), width)
+
+	title = highlightRunes(title, it.matches, titleStyle)
+	desc = highlightRunes(desc, it.descMatches, descStyle)
+
+	fmt.Fprintf(w, "%s\n%s", titleStyle.Render(title), descStyle.Render(desc))
+}
+
+func highlightRunes(s string, positions []int, base lipgloss.Style) string {
+	if len(positions) == 0 {
+		return s
+	}
+	unmatched := base.Inline(true)
+	matched := unmatched.Inherit(searchMatchStyle)
+	return lipgloss.StyleRunes(s, positions, matched, unmatched)
+}
+
+// truncateRunes cuts s to at most width runes, marking the cut with an ellipsis.
+func truncateRunes(s string, width int) string {
+	runes := []rune(s)
+	if width <= 0 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
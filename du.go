@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+)
+
+// DirUsage is the total size of a directory and everything below it. Hard
+// linked files are counted once, symlinks are not followed and, like du -x,
+// other filesystems mounted below it are left out.
+type DirUsage struct {
+	// Size is the apparent size, what ls shows
+	Size int64
+	// Disk is the space allocated on disk, what du shows
+	Disk  int64
+	Files int64
+	Dirs  int64
+	// Errors counts directories and entries that could not be read, the
+	// totals leave them out
+	Errors int64
+}
+
+func (u *DirUsage) add(o DirUsage) {
+	u.Size += o.Size
+	u.Disk += o.Disk
+	u.Files += o.Files
+	u.Dirs += o.Dirs
+	u.Errors += o.Errors
+}
+
+// fileKey identifies an inode, to count hard links once
+type fileKey struct {
+	dev, ino uint64
+}
+
+// Usage returns the measured size of the subtree below n, if it has been
+// measured since it last changed.
+func (n *Node) Usage() (DirUsage, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.usage == nil {
+		return DirUsage{}, false
+	}
+	return *n.usage, true
+}
+
+func (n *Node) setUsage(u DirUsage) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.usage = &u
+}
+
+// invalidateUsage forgets the measured size of n and of every directory
+// above it, they all include whatever changed in n.
+func invalidateUsage(n *Node) {
+	for ; n != nil; n = n.Parent() {
+		n.mu.Lock()
+		n.usage = nil
+		n.mu.Unlock()
+	}
+}
+
+// MeasureDir adds up the size of the subtree at path on fsys with a pool of
+// workers reading directories in parallel.
+func MeasureDir(ctx context.Context, fsys FS, path string, workers int) (DirUsage, error) {
+	if workers <= 0 {
+		workers = 4
+	}
+	var (
+		mu    sync.Mutex
+		total DirUsage
+		seen  = map[fileKey]bool{}
+	)
+	info, err := fsys.Lstat(path)
+	if err != nil {
+		return total, err
+	}
+	total.Dirs = 1
+	total.Size = info.Size()
+	total.Disk = diskUsage(info)
+	dev := fileDevice(info)
+
+	err = runQueue(ctx, workers, []string{path}, func(dir string) []string {
+		var local DirUsage
+		var subdirs []string
+		entries, err := readDir(fsys, dir)
+		if err != nil {
+			local.Errors++
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				local.Errors++
+				continue
+			}
+			if info.IsDir() {
+				if fileDevice(info) != dev {
+					continue
+				}
+				local.Dirs++
+				subdirs = append(subdirs, filepath.Join(dir, entry.Name()))
+			} else {
+				if key, shared := hardLinkKey(info); shared {
+					mu.Lock()
+					dup := seen[key]
+					seen[key] = true
+					mu.Unlock()
+					if dup {
+						continue
+					}
+				}
+				local.Files++
+			}
+			local.Size += info.Size()
+			local.Disk += diskUsage(info)
+		}
+		mu.Lock()
+		total.add(local)
+		mu.Unlock()
+		return subdirs
+	})
+	return total, err
+}
+
+// isMountPoint reports whether n is on another filesystem than its parent.
+func isMountPoint(n *Node) bool {
+	parent := n.Parent()
+	return parent != nil && n.metadata.Dev != 0 && parent.metadata.Dev != 0 &&
+		n.metadata.Dev != parent.metadata.Dev
+}
+
+// MeasureDirs measures every directory in nodes that has no size yet, one
+// after the other, caches the totals on the nodes and sends each node on
+// measured as soon as its total is known. Mount points are skipped. The
+// caller owns measured and should close it once MeasureDirs returns.
+func (e *Engine) MeasureDirs(ctx context.Context, nodes []*Node, workers int, measured chan<- *Node) error {
+	for _, n := range nodes {
+		if !n.metadata.IsDir || n.metadata.IsSymlink || isMountPoint(n) {
+			continue
+		}
+		if _, ok := n.Usage(); ok {
+			continue
+		}
+		usage, err := MeasureDir(ctx, n.FS(), n.metadata.Path, workers)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			usage.Errors++
+		}
+		n.setUsage(usage)
+		select {
+		case measured <- n:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMeasureDir(t *testing.T) {
+	root := makeTree(t, "a/one", "a/b/two", "a/b/c/three")
+	if err := os.WriteFile(filepath.Join(root, "a", "big"), make([]byte, 10000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a second name for big must not count twice
+	if err := os.Link(filepath.Join(root, "a", "big"), filepath.Join(root, "a", "b", "big-link")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "a", "loop")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	u, err := MeasureDir(context.Background(), localFS, filepath.Join(root, "a"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Files != 5 || u.Dirs != 3 {
+		t.Errorf("files %d, dirs %d, want 5 files (one link) and 3 dirs", u.Files, u.Dirs)
+	}
+	if u.Size < 10000 || u.Size > 10000+3*4096+100+int64(len(root))+64 {
+		t.Errorf("size = %d, want big counted once", u.Size)
+	}
+	if u.Errors != 0 {
+		t.Errorf("errors = %d", u.Errors)
+	}
+}
+
+func TestMeasureDirs_CachesAndSortsBySize(t *testing.T) {
+	fsys, root := makeMemTree(t, "small/x", "large/y", "file.txt")
+	if err := fsys.WriteFile(filepath.Join(root, "large", "y"), make([]byte, 50000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+	children := engine.current.Children()
+
+	measured := make(chan *Node, len(children))
+	if err := engine.MeasureDirs(context.Background(), children, 2, measured); err != nil {
+		t.Fatal(err)
+	}
+	close(measured)
+	count := 0
+	for n := range measured {
+		if _, ok := n.Usage(); !ok {
+			t.Errorf("%s sent without a size", n.metadata.Path)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("measured %d directories, want 2", count)
+	}
+
+	list := sortNodes(children, SortMode{Key: SortSize, Reverse: true, DirsFirst: true})
+	if got := names(list); got != "large small file.txt" {
+		t.Errorf("by size = %q", got)
+	}
+
+	large := nodeAt(engine.current, filepath.Join("large", "y")).parent
+	invalidateUsage(large)
+	if _, ok := large.Usage(); ok {
+		t.Error("invalidated size still cached")
+	}
+}
+
+func TestUsageItems_RankedBySize(t *testing.T) {
+	fsys, root := makeMemTree(t, "small.txt", "dir/a", "dir/b")
+	if err := fsys.WriteFile(filepath.Join(root, "dir", "a"), make([]byte, 3000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+	dir := nodeAt(engine.current, "dir")
+	u, err := MeasureDir(context.Background(), fsys, dir.metadata.Path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir.setUsage(u)
+
+	items := usageItems(engine.current)
+	if len(items) != 2 {
+		t.Fatalf("got %d items", len(items))
+	}
+	first, second := items[0].(usageItem), items[1].(usageItem)
+	if first.node != dir || first.items != 2 || !first.measured {
+		t.Errorf("first = %+v, want dir with 2 items", first)
+	}
+	if share := first.share + second.share; share < 0.999 || share > 1.001 {
+		t.Errorf("shares add up to %f", share)
+	}
+}
+
+func TestEngine_Delete(t *testing.T) {
+	fsys, root := makeMemTree(t, "keep.txt", "junk/a/b", "junk/c")
+	engine := newMemEngine(t, fsys, root)
+	junk := nodeAt(engine.current, "junk")
+	engine.current.setUsage(DirUsage{Size: 1})
+
+	if err := engine.Delete(engine.current); err == nil {
+		t.Error("deleting the current directory should fail")
+	}
+	if err := engine.Delete(junk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(root, "junk")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("junk still there: %v", err)
+	}
+	if got := names(engine.current.Children()); got != "keep.txt" {
+		t.Errorf("children = %q", got)
+	}
+	if _, ok := engine.current.Usage(); ok {
+		t.Error("the parent's size should be forgotten")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// dupePartialLen is how much of the head and of the tail of a file the
+// partial hash reads. Files up to twice this long are hashed whole.
+const dupePartialLen = 4096
+
+// DupeGroup is a set of files with identical contents.
+type DupeGroup struct {
+	Size int64
+	// Hash is the hex SHA-256 of the contents
+	Hash  string
+	Files []*Node
+}
+
+// Wasted is the space the copies beyond the first take.
+func (g DupeGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// FindDuplicates looks for files with the same contents below root. Files
+// are grouped by size first, then by a hash of their head and tail, and
+// only files that still collide get a full SHA-256, so most files are
+// never read in full. Hashing runs on workers goroutines. Empty files,
+// symlinks, and further names of an already seen inode are left out.
+// Groups are returned biggest waste first.
+func (e *Engine) FindDuplicates(ctx context.Context, root *Node, workers int) ([]DupeGroup, error) {
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var (
+		mu     sync.Mutex
+		bySize = map[int64][]*Node{}
+		inodes = map[fileKey]bool{}
+	)
+	err := walkTree(ctx, root, workers, 0, func(n *Node, rel string, depth int) bool {
+		m := n.metadata
+		if m.IsDir || m.IsSymlink || m.Size == 0 || n.Err() != nil {
+			return true
+		}
+		if m.Mode != 0 && !m.Mode.IsRegular() {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if m.Inode != 0 {
+			key := fileKey{dev: m.Dev, ino: m.Inode}
+			if inodes[key] {
+				return true
+			}
+			inodes[key] = true
+		}
+		bySize[m.Size] = append(bySize[m.Size], n)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*Node
+	for _, nodes := range bySize {
+		if len(nodes) > 1 {
+			candidates = append(candidates, nodes...)
+		}
+	}
+
+	partial, err := hashNodes(ctx, candidates, workers, partialHash)
+	if err != nil {
+		return nil, err
+	}
+	var full []*Node
+	for _, group := range groupByHash(candidates, partial) {
+		// small files were read whole, their partial hash is the full one
+		if group[0].metadata.Size > 2*dupePartialLen {
+			full = append(full, group...)
+		}
+	}
+	fullHashes, err := hashNodes(ctx, full, workers, fullHash)
+	if err != nil {
+		return nil, err
+	}
+	for n, h := range fullHashes {
+		partial[n] = h
+	}
+
+	var groups []DupeGroup
+	for _, group := range groupByHash(candidates, partial) {
+		sort.Slice(group, func(i, j int) bool { return group[i].metadata.Path < group[j].metadata.Path })
+		groups = append(groups, DupeGroup{
+			Size:  group[0].metadata.Size,
+			Hash:  partial[group[0]],
+			Files: group,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Wasted() != groups[j].Wasted() {
+			return groups[i].Wasted() > groups[j].Wasted()
+		}
+		return groups[i].Files[0].metadata.Path < groups[j].Files[0].metadata.Path
+	})
+	return groups, nil
+}
+
+// groupByHash returns the sets of nodes with the same size and hash that
+// have more than one member. Nodes without a hash are dropped.
+func groupByHash(nodes []*Node, hashes map[*Node]string) [][]*Node {
+	type key struct {
+		size int64
+		hash string
+	}
+	byKey := map[key][]*Node{}
+	for _, n := range nodes {
+		if h, ok := hashes[n]; ok {
+			k := key{n.metadata.Size, h}
+			byKey[k] = append(byKey[k], n)
+		}
+	}
+	var groups [][]*Node
+	for _, g := range byKey {
+		if len(g) > 1 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// hashNodes hashes nodes with a pool of workers. Files that cannot be
+// read are left out of the result.
+func hashNodes(ctx context.Context, nodes []*Node, workers int, hash func(fsys FS, path string, size int64) (string, error)) (map[*Node]string, error) {
+	var (
+		mu     sync.Mutex
+		hashes = make(map[*Node]string, len(nodes))
+		wg     sync.WaitGroup
+		jobs   = make(chan *Node)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				h, err := hash(n.FS(), n.metadata.Path, n.metadata.Size)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				hashes[n] = h
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, n := range nodes {
+		select {
+		case jobs <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return hashes, nil
+}
+
+// partialHash hashes the first and last dupePartialLen bytes of a file,
+// or all of it when it is short.
+func partialHash(fsys FS, path string, size int64) (string, error) {
+	if size <= 2*dupePartialLen {
+		return fullHash(fsys, path, size)
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, dupePartialLen)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return "", err
+	}
+	h.Write(buf)
+	// skip to the tail, by seeking where the file allows it
+	if s, ok := f.(io.Seeker); ok {
+		if _, err := s.Seek(size-dupePartialLen, io.SeekStart); err != nil {
+			return "", err
+		}
+	} else if _, err := io.CopyN(io.Discard, f, size-2*dupePartialLen); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return "", err
+	}
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fullHash(fsys FS, path string, size int64) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	// a file that changed while we read it is no reliable duplicate
+	if n != size {
+		return "", fmt.Errorf("%s changed while hashing", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DeleteDuplicate deletes dup after reading it and keep again, a file
+// edited since the scan is no copy any more and is left alone.
+func (e *Engine) DeleteDuplicate(keep, dup *Node) error {
+	if keep == dup {
+		return errors.New("cannot delete the copy that is kept")
+	}
+	if err := stillDuplicate(keep, dup); err != nil {
+		return err
+	}
+	return e.Delete(dup)
+}
+
+// stillDuplicate hashes keep and dup in full and fails unless both are
+// still regular files with the same contents.
+func stillDuplicate(keep, dup *Node) error {
+	var hashes [2]string
+	for i, n := range []*Node{keep, dup} {
+		info, err := n.FS().Stat(n.metadata.Path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is no longer a regular file", n.metadata.Path)
+		}
+		if hashes[i], err = fullHash(n.FS(), n.metadata.Path, info.Size()); err != nil {
+			return err
+		}
+	}
+	if hashes[0] != hashes[1] {
+		return fmt.Errorf("%s no longer matches %s", dup.metadata.Path, keep.metadata.Path)
+	}
+	return nil
+}
+
+// ReplaceWithLink replaces dup with a hard link to keep, so both names
+// share one copy of the data. The link is made next to dup first and then
+// renamed over it, dup is never missing.
+func (e *Engine) ReplaceWithLink(keep, dup *Node) error {
+	if keep == dup {
+		return errors.New("cannot link a file to itself")
+	}
+	fsys := dup.FS()
+	linker, ok := fsys.(Linker)
+	if !ok || keep.FS() != fsys {
+		return errors.New("hard links are not supported here")
+	}
+	ki, err := fsys.Stat(keep.metadata.Path)
+	if err != nil {
+		return err
+	}
+	di, err := fsys.Stat(dup.metadata.Path)
+	if err != nil {
+		return err
+	}
+	if ki.Sys() != nil && os.SameFile(ki, di) {
+		return nil
+	}
+	if err := stillDuplicate(keep, dup); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(dup.metadata.Path)
+	tmp := filepath.Join(dir, fmt.Sprintf(".%s.link-%d", filepath.Base(dup.metadata.Path), os.Getpid()))
+	if err := linker.Link(keep.metadata.Path, tmp); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, dup.metadata.Path); err != nil {
+		fsys.RemoveAll(tmp)
+		return err
+	}
+	parent := dup.Parent()
+	patchChild(parent, filepath.Base(dup.metadata.Path))
+	invalidateUsage(parent)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	root := t.TempDir()
+	big := bytes.Repeat([]byte("0123456789"), 2000)
+	// same size, head and tail as big, only the middle differs
+	almost := append([]byte(nil), big...)
+	almost[len(almost)/2] = 'x'
+
+	writeFile(t, filepath.Join(root, "a.txt"), []byte("hello"))
+	writeFile(t, filepath.Join(root, "sub", "b.txt"), []byte("hello"))
+	writeFile(t, filepath.Join(root, "c.txt"), []byte("world"))
+	writeFile(t, filepath.Join(root, "big1"), big)
+	writeFile(t, filepath.Join(root, "sub", "big2"), big)
+	writeFile(t, filepath.Join(root, "almost"), almost)
+	writeFile(t, filepath.Join(root, "empty1"), nil)
+	writeFile(t, filepath.Join(root, "empty2"), nil)
+	// a second name of a.txt is the same file, not a copy
+	if err := os.Link(filepath.Join(root, "a.txt"), filepath.Join(root, "a-link.txt")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+
+	engine := NewEngine(root)
+	groups, err := engine.FindDuplicates(context.Background(), engine.current, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(groups), groups)
+	}
+	if names(groups[0].Files) != "big1 big2" || groups[0].Wasted() != int64(len(big)) {
+		t.Errorf("first group = %s, wasted %d", names(groups[0].Files), groups[0].Wasted())
+	}
+	if len(groups[1].Files) != 2 || groups[1].Size != 5 || len(groups[1].Hash) != 64 {
+		t.Errorf("second group = %s size %d hash %q", names(groups[1].Files), groups[1].Size, groups[1].Hash)
+	}
+}
+
+func TestDeleteDuplicate_RechecksContents(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "keep"), []byte("same"))
+	writeFile(t, filepath.Join(root, "edited"), []byte("same"))
+	writeFile(t, filepath.Join(root, "copy"), []byte("same"))
+	engine := NewEngine(root)
+	keep := nodeAt(engine.current, "keep")
+
+	// edited in place, the size stays the same
+	writeFile(t, filepath.Join(root, "edited"), []byte("diff"))
+	if err := engine.DeleteDuplicate(keep, nodeAt(engine.current, "edited")); err == nil {
+		t.Error("a file edited since the scan was deleted")
+	}
+	if _, err := os.Stat(filepath.Join(root, "edited")); err != nil {
+		t.Errorf("edited file is gone: %v", err)
+	}
+
+	if err := engine.DeleteDuplicate(keep, nodeAt(engine.current, "copy")); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(engine.current.Children()); got != "edited keep" {
+		t.Errorf("children = %q, want the copy deleted", got)
+	}
+}
+
+func TestReplaceWithLink(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "keep"), []byte("same"))
+	writeFile(t, filepath.Join(root, "dup"), []byte("same"))
+	engine := NewEngine(root)
+	dup := nodeAt(engine.current, "dup")
+	keep := nodeAt(engine.current, "keep")
+
+	if err := engine.ReplaceWithLink(keep, dup); err != nil {
+		t.Fatal(err)
+	}
+	ki, _ := os.Stat(filepath.Join(root, "keep"))
+	di, _ := os.Stat(filepath.Join(root, "dup"))
+	if !os.SameFile(ki, di) {
+		t.Error("dup is not a hard link to keep")
+	}
+	if got := names(engine.current.Children()); got != "dup keep" {
+		t.Errorf("children = %q, want the temporary link gone", got)
+	}
+
+	writeFile(t, filepath.Join(root, "other"), []byte("different length"))
+	patchChild(engine.current, "other")
+	if err := engine.ReplaceWithLink(keep, nodeAt(engine.current, "other")); err == nil {
+		t.Error("expected files of different sizes to be refused")
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// dupesModel is the duplicate finder view: groups of identical files below
+// root, with copies marked for deleting or linking.
+type dupesModel struct {
+	list   list.Model
+	root   *Node
+	groups []DupeGroup
+	marked map[*Node]bool
+
+	seq      int
+	cancel   context.CancelFunc
+	scanning bool
+
+	// confirm is the action waiting for a y, "delete" or "link"
+	confirm string
+	notice  string
+	err     error
+}
+
+// dupeItem is a group header when node is nil, a file of the group
+// otherwise.
+type dupeItem struct {
+	group  int
+	header DupeGroup
+	node   *Node
+	rel    string
+	marked bool
+}
+
+func (i dupeItem) FilterValue() string {
+	if i.node == nil {
+		return ""
+	}
+	return i.node.metadata.Path
+}
+
+// dupesFoundMsg is sent when a duplicate scan has finished
+type dupesFoundMsg struct {
+	seq    int
+	groups []DupeGroup
+	err    error
+}
+
+// dupesActionMsg is sent when deleting or linking marked copies is done.
+// done holds the copies that were handled.
+type dupesActionMsg struct {
+	done []*Node
+	err  error
+}
+
+type dupeDelegate struct{}
+
+func (d dupeDelegate) Height() int                             { return 1 }
+func (d dupeDelegate) Spacing() int                            { return 0 }
+func (d dupeDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d dupeDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	it, ok := listItem.(dupeItem)
+	if !ok {
+		return
+	}
+	cursor := "  "
+	if index == m.Index() {
+		cursor = accentStyle.Render("▌ ")
+	}
+	g := it.header
+	if it.node == nil {
+		line := fmt.Sprintf("%d copies of %s, %s wasted", len(g.Files), formatSize(g.Size), formatSize(g.Wasted()))
+		fmt.Fprint(w, cursor+headerStyle.Render(line)+titleMutedStyle.Render("  sha256 "+g.Hash[:12]))
+		return
+	}
+
+	box, style := "[ ]", lipgloss.NewStyle()
+	if it.marked {
+		box, style = "[x]", highPriorityStyle
+	}
+	name := truncateRunes(it.rel, max(1, m.Width()-8))
+	fmt.Fprint(w, cursor+"  "+style.Render(box+" "+name))
+}
+
+// openDupes shows the duplicate finder and starts scanning below root.
+func (m *model) openDupes(root *Node) tea.Cmd {
+	m.views.Push(m.currentView)
+	m.currentView = dupesView
+	m.dupes.root = root
+	return m.scanDupes()
+}
+
+func (m *model) scanDupes() tea.Cmd {
+	m.stopDupes()
+	m.dupes.groups = nil
+	m.dupes.marked = map[*Node]bool{}
+	m.dupes.confirm = ""
+	m.dupes.notice = ""
+	m.dupes.err = nil
+	m.dupes.scanning = true
+	m.dupes.list.SetItems(nil)
+	m.dupes.list.ResetSelected()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.dupes.cancel = cancel
+	seq := m.dupes.seq
+	engine := m.engine
+	root := m.dupes.root
+	workers := m.search.opts.Workers
+	return func() tea.Msg {
+		groups, err := engine.FindDuplicates(ctx, root, workers)
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		return dupesFoundMsg{seq: seq, groups: groups, err: err}
+	}
+}
+
+// stopDupes cancels a running scan and makes sure its result is ignored.
+func (m *model) stopDupes() {
+	if m.dupes.cancel != nil {
+		m.dupes.cancel()
+		m.dupes.cancel = nil
+	}
+	m.dupes.seq++
+	m.dupes.scanning = false
+}
+
+// dupesItems flattens the groups into list rows.
+func (d dupesModel) dupesItems() []list.Item {
+	var items []list.Item
+	for gi, g := range d.groups {
+		items = append(items, dupeItem{group: gi, header: g})
+		for _, n := range g.Files {
+			rel, err := filepath.Rel(d.root.metadata.Path, n.metadata.Path)
+			if err != nil {
+				rel = n.metadata.Path
+			}
+			items = append(items, dupeItem{group: gi, header: g, node: n, rel: rel, marked: d.marked[n]})
+		}
+	}
+	return items
+}
+
+// toggleMark marks or unmarks the copy under the cursor. On a group header
+// it marks every copy but the first, or clears the group if that is done
+// already. The last unmarked file of a group cannot be marked, one copy
+// always stays.
+func (m *model) toggleMark() {
+	it, ok := m.dupes.list.SelectedItem().(dupeItem)
+	if !ok {
+		return
+	}
+	g := m.dupes.groups[it.group]
+	unmarked := 0
+	for _, n := range g.Files {
+		if !m.dupes.marked[n] {
+			unmarked++
+		}
+	}
+
+	if it.node != nil {
+		switch {
+		case m.dupes.marked[it.node]:
+			delete(m.dupes.marked, it.node)
+		case unmarked > 1:
+			m.dupes.marked[it.node] = true
+		default:
+			m.dupes.notice = "one copy of every file has to stay"
+		}
+		return
+	}
+	if unmarked == 1 && !m.dupes.marked[g.Files[0]] {
+		for _, n := range g.Files {
+			delete(m.dupes.marked, n)
+		}
+		return
+	}
+	for i, n := range g.Files {
+		if i == 0 {
+			delete(m.dupes.marked, n)
+		} else {
+			m.dupes.marked[n] = true
+		}
+	}
+}
+
+// applyDupes deletes the marked copies, or replaces them with hard links to
+// the first unmarked file of their group.
+func (m *model) applyDupes(action string) tea.Cmd {
+	type job struct{ keep, dup *Node }
+	var jobs []job
+	for _, g := range m.dupes.groups {
+		var keep *Node
+		for _, n := range g.Files {
+			if !m.dupes.marked[n] {
+				keep = n
+				break
+			}
+		}
+		for _, n := range g.Files {
+			if m.dupes.marked[n] && keep != nil {
+				jobs = append(jobs, job{keep: keep, dup: n})
+			}
+		}
+	}
+	engine := m.engine
+	return func() tea.Msg {
+		var done []*Node
+		var errs []error
+		for _, j := range jobs {
+			var err error
+			if action == "link" {
+				err = engine.ReplaceWithLink(j.keep, j.dup)
+			} else {
+				err = engine.DeleteDuplicate(j.keep, j.dup)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			done = append(done, j.dup)
+		}
+		return dupesActionMsg{done: done, err: errors.Join(errs...)}
+	}
+}
+
+func (m *model) updateDupesView(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case dupesFoundMsg:
+		if msg.seq != m.dupes.seq {
+			return nil
+		}
+		m.dupes.scanning = false
+		m.dupes.cancel = nil
+		m.dupes.err = msg.err
+		m.dupes.groups = msg.groups
+		return m.dupes.list.SetItems(m.dupes.dupesItems())
+	case dupesActionMsg:
+		// drop what was handled, and groups that no longer have copies
+		done := map[*Node]bool{}
+		for _, n := range msg.done {
+			done[n] = true
+			delete(m.dupes.marked, n)
+		}
+		groups := m.dupes.groups[:0]
+		for _, g := range m.dupes.groups {
+			var files []*Node
+			for _, n := range g.Files {
+				if !done[n] {
+					files = append(files, n)
+				}
+			}
+			if len(files) > 1 {
+				g.Files = files
+				groups = append(groups, g)
+			}
+		}
+		m.dupes.groups = groups
+		m.dupes.err = msg.err
+		m.dupes.notice = fmt.Sprintf("%d copies handled", len(msg.done))
+		return m.dupes.list.SetItems(m.dupes.dupesItems())
+	case tea.KeyMsg:
+		if m.dupes.confirm != "" {
+			action := m.dupes.confirm
+			m.dupes.confirm = ""
+			if msg.String() == "y" {
+				return m.applyDupes(action)
+			}
+			return nil
+		}
+		if m.dupes.list.FilterState() == list.Filtering {
+			break
+		}
+		m.dupes.notice = ""
+		switch msg.String() {
+		case "esc", "q":
+			m.stopDupes()
+			if view, ok := m.views.Pop(); ok {
+				m.currentView = view
+			}
+			return nil
+		case " ", "x":
+			m.toggleMark()
+			return m.dupes.list.SetItems(m.dupes.dupesItems())
+		case "d", "L":
+			if len(m.dupes.marked) == 0 {
+				m.dupes.notice = "mark copies with space first"
+				return nil
+			}
+			m.dupes.confirm = "delete"
+			if msg.String() == "L" {
+				m.dupes.confirm = "link"
+			}
+			return nil
+		case "r":
+			return m.scanDupes()
+		}
+	}
+	var cmd tea.Cmd
+	m.dupes.list, cmd = m.dupes.list.Update(msg)
+	return cmd
+}
+
+func (m model) renderDupesView() string {
+	header := headerStyle.Render("Duplicates") + " " + titlePathStyle.Render(m.dupes.root.metadata.Path)
+
+	var wasted int64
+	for _, g := range m.dupes.groups {
+		wasted += g.Wasted()
+	}
+	var marked int64
+	for n := range m.dupes.marked {
+		marked += n.metadata.Size
+	}
+	summary := fmt.Sprintf("%d groups, %s wasted, %d marked (%s)",
+		len(m.dupes.groups), formatSize(wasted), len(m.dupes.marked), formatSize(marked))
+	if m.dupes.scanning {
+		summary = accentStyle.Render("scanning and hashing…")
+	}
+
+	var footer string
+	switch {
+	case m.dupes.confirm == "delete":
+		footer = warningStyle.Render(fmt.Sprintf("Delete %d marked copies? y/n", len(m.dupes.marked)))
+	case m.dupes.confirm == "link":
+		footer = warningStyle.Render(fmt.Sprintf("Replace %d marked copies with hard links? y/n", len(m.dupes.marked)))
+	case m.dupes.err != nil:
+		footer = highPriorityStyle.Render("✗ " + m.dupes.err.Error())
+	case m.dupes.notice != "":
+		footer = successStyle.Render(m.dupes.notice)
+	default:
+		footer = titleAccentStyle.Render("space") + titleMutedStyle.Render(" mark  ") +
+			titleAccentStyle.Render("d") + titleMutedStyle.Render(" delete marked  ") +
+			titleAccentStyle.Render("L") + titleMutedStyle.Render(" hard link marked  ") +
+			titleAccentStyle.Render("r") + titleMutedStyle.Render(" rescan  ") +
+			titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back")
+	}
+	return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, header, summary, "", m.dupes.list.View(), footer))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorFinishedMsg is sent when the editor started by openInEditor exits
+type editorFinishedMsg struct {
+	err error
+}
+
+// openInEditor suspends the TUI and opens path at line in $VISUAL or
+// $EDITOR, falling back to vi.
+func openInEditor(path string, line int) tea.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// $EDITOR may carry its own flags, like "code --wait"
+	fields := strings.Fields(editor)
+	args := append(fields[1:], editorLineArgs(fields[0], path, line)...)
+	cmd := exec.Command(fields[0], args...)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return editorFinishedMsg{err: err}
+	})
+}
+
+// editorLineArgs returns the arguments that make editor open path at line.
+func editorLineArgs(editor, path string, line int) []string {
+	if line <= 0 {
+		return []string{path}
+	}
+	switch strings.TrimSuffix(filepath.Base(editor), ".exe") {
+	case "code", "code-insiders", "codium", "subl":
+		return []string{"-g", fmt.Sprintf("%s:%d", path, line)}
+	}
+	// vi, vim, nvim, nano, emacs, micro, kak and most others
+	return []string{fmt.Sprintf("+%d", line), path}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	// "fmt"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 )
@@ -19,14 +22,46 @@ type Engine struct {
 	
 	root *Node
 	current  *Node
+
+	// index answers recursive searches when it is fresh, may be nil
+	index *Index
+	// watcher keeps visited directories in sync with the disk, may be nil
+	watcher *Watcher
+	// cache unloads directories that have not been used for a while
+	cache *NodeCache
+	// followLinks lets the user enter symlinked directories
+	followLinks bool
+	// sorts holds the sort mode of each directory
+	sorts *SortPrefs
+	// filter hides entries from List, hidden counts what the last List hid
+	filter *listFilter
+	hidden FilterStats
+	// archives are the archives opened so far, closed with the engine
+	archives []*archiveFS
+	// frecency records the directories visited, may be nil
+	frecency *Frecency
 };
 
 type Node struct {
+	mu sync.Mutex
+
+	// cache is shared by the whole tree, may be nil
+	cache *NodeCache
+	// fsys is the filesystem the node lives on, nil means the local disk
+	fsys FS
+
 	parent *Node
 	children []*Node
 	metadata *NodeMetadata
 	loaded bool
 	err error 
+
+	// usage is the measured size of a directory's subtree, nil until then
+	usage *DirUsage
+	// mounted shows the contents of an archive file, nil until opened
+	mounted *Node
+	// loading is closed when the read in progress finishes, nil when idle
+	loading chan struct{}
 };
 
 type NodeMetadata struct {
@@ -35,17 +70,39 @@ type NodeMetadata struct {
 	IsDir    bool
 	Size     int64
 	ModTime  time.Time
+
+	// For symlinks IsDir, Size and ModTime describe the target
+	IsSymlink  bool
+	LinkTarget string
+	BrokenLink bool
+
+	// Mode and the fields below come from lstat, so for a symlink they
+	// describe the link itself. They are zero where the platform has none.
+	Mode       os.FileMode
+	Uid, Gid   uint32
+	Inode      uint64
+	Nlink      uint64
+	Dev        uint64
+	AccessTime time.Time
+	ChangeTime time.Time
+
+	// PackedSize is the compressed size of an archive entry, 0 elsewhere
+	PackedSize int64
+	// ArchiveOwner is the user:group a tar entry records, empty elsewhere
+	ArchiveOwner string
 }
 
 
 func NewNode(path string, parent *Node) (*Node, error){
-	metadata, err:= NewNodeMetadata(path);
+	fsys := parent.FS()
+	metadata, err:= NewNodeMetadataFS(fsys, path);
 	if(err!=nil){
-		fmt.Println(err);
 		return nil, err;
 	}
 	nd:= &Node{
 		parent: parent,
+		cache: parent.cacheOrNil(),
+		fsys: fsys,
 		children: []*Node{}, 
 		metadata: metadata,
 		loaded: false, 
@@ -54,8 +111,58 @@ func NewNode(path string, parent *Node) (*Node, error){
 	return nd, nil;
 
 }
+// newFailedNode keeps an entry that could not be stat'ed in the tree, like a
+// broken symlink or a file deleted while its directory was read, so the
+// list can show it with the reason instead of losing it. It counts as
+// loaded, there is nothing more to read.
+func newFailedNode(path string, isDir bool, parent *Node, err error) *Node {
+	metadata := &NodeMetadata{Name: path, Path: path, IsDir: isDir}
+	if info, lerr := parent.FS().Lstat(path); lerr == nil {
+		metadata.Size = info.Size()
+		metadata.ModTime = info.ModTime()
+		metadata.IsSymlink = info.Mode()&os.ModeSymlink != 0
+		fillStatMetadata(metadata, info)
+	}
+	return &Node{
+		parent:   parent,
+		cache:    parent.cacheOrNil(),
+		fsys:     parent.FS(),
+		children: []*Node{},
+		metadata: metadata,
+		loaded:   true,
+		err:      err,
+	}
+}
+
+// Err returns why n, or its directory listing, could not be read.
+func (n *Node) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *Node) cacheOrNil() *NodeCache {
+	if n == nil {
+		return nil
+	}
+	return n.cache
+}
+
+// FS returns the filesystem n lives on.
+func (n *Node) FS() FS {
+	if n == nil || n.fsys == nil {
+		return localFS
+	}
+	return n.fsys
+}
+
+// NewNodeMetadata reads the metadata of path on the local disk.
 func NewNodeMetadata(path string) (*NodeMetadata, error){
-	info, err:= os.Stat(path);
+	return NewNodeMetadataFS(localFS, path)
+}
+
+func NewNodeMetadataFS(fsys FS, path string) (*NodeMetadata, error){
+	info, err:= fsys.Lstat(path);
 	if(err!=nil){
 		return nil, err;
 	}
@@ -67,106 +174,662 @@ func NewNodeMetadata(path string) (*NodeMetadata, error){
 		ModTime: info.ModTime(),
 		
 	}
+	fillStatMetadata(metadata, info)
+	fillArchiveMetadata(metadata, info)
+	if info.Mode()&os.ModeSymlink != 0 {
+		metadata.IsSymlink = true
+		metadata.LinkTarget, _ = fsys.Readlink(path)
+		// describe the target, so a followed link behaves like what it points at
+		if target, err := fsys.Stat(path); err == nil {
+			metadata.IsDir = target.IsDir()
+			metadata.Size = target.Size()
+			metadata.ModTime = target.ModTime()
+		} else {
+			metadata.BrokenLink = true
+		}
+	}
 	return metadata, nil;
 }
 func NewEngine(path string) *Engine {
-
-	rootNode, err:= NewNode(path, nil);
-	if err!=nil {
+	e, err := NewEngineFS(localFS, path)
+	if err != nil {
 		panic(err);
 	}
+	return e
+}
+
+// OpenEngine browses location, a local directory or a webdav:// share,
+// with the credentials from cfg.
+func OpenEngine(location string, cfg *Config) (*Engine, error) {
+	if isRemote(location) {
+		fsys, path, err := OpenWebDAV(location, cfg.WebDAV)
+		if err != nil {
+			return nil, err
+		}
+		return NewEngineFS(fsys, path)
+	}
+	return NewEngineFS(localFS, location)
+}
+
+// NewEngineFS browses fsys, starting at path.
+func NewEngineFS(fsys FS, path string) (*Engine, error) {
+	rootNode := &Node{fsys: fsys, children: []*Node{}}
+	metadata, err := NewNodeMetadataFS(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	rootNode.metadata = metadata
+	cache := NewNodeCache(DefaultCacheBudget)
+	rootNode.cache = cache
+	cache.pin(rootNode)
 	loadChildren(rootNode);
 	return &Engine{
 		root: rootNode,
 		current: rootNode,
-	};
+		cache: cache,
+		followLinks: true,
+		sorts: OpenSortPrefs(""),
+		filter: newListFilter(),
+	}, nil
+}
+
+// Filter returns which entries List hides.
+func (e *Engine) Filter() FilterOptions {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.filter.opts
+}
+
+// SetFilter changes which entries List hides. Ignore files are read again,
+// so toggling a filter also picks up changes the watcher cannot see.
+func (e *Engine) SetFilter(opts FilterOptions) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filter.opts = opts
+	e.filter.ignores.reset()
+}
+
+// DirChanged tells the engine the entries of dir changed on disk, so
+// what it derived from them is worked out again.
+func (e *Engine) DirChanged(dir *Node) {
+	e.filter.ignores.forget(dir.metadata.Path)
+}
+
+// SetExclude sets the name globs that HideExcluded hides.
+func (e *Engine) SetExclude(patterns []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.filter.exclude = patterns
+}
+
+// Hidden returns how many entries the last List left out.
+func (e *Engine) Hidden() FilterStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.hidden
+}
+
+// SetSortPrefs replaces the remembered sort modes, usually with ones loaded
+// from disk.
+func (e *Engine) SetSortPrefs(p *SortPrefs) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sorts = p
+}
+
+// SortMode returns how the current directory is listed.
+func (e *Engine) SortMode() SortMode {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sorts.Get(nodeLocation(e.current))
+}
+
+// SetSortMode changes how the current directory is listed and remembers it.
+func (e *Engine) SetSortMode(mode SortMode) error {
+	e.mu.Lock()
+	sorts, location := e.sorts, nodeLocation(e.current)
+	e.mu.Unlock()
+	return sorts.Set(location, mode)
 }
+
+// SetFollowSymlinks decides whether symlinked directories can be entered or
+// are only shown as links.
+func (e *Engine) SetFollowSymlinks(follow bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.followLinks = follow
+}
+
+// CanEnter reports why n cannot become the current directory: it is not a
+// directory, it is a link and links are not followed, or it is a link back
+// to one of its own ancestors, which would let us descend forever.
+func (e *Engine) CanEnter(n *Node) error {
+	e.mu.Lock()
+	follow := e.followLinks
+	e.mu.Unlock()
+	return checkEnter(n, follow)
+}
+
+func checkEnter(n *Node, follow bool) error {
+	if !n.metadata.IsDir {
+		return errors.New("not a directory")
+	}
+	if !n.metadata.IsSymlink {
+		return nil
+	}
+	if !follow {
+		return fmt.Errorf("%s is a link to %s", filepath.Base(n.metadata.Path), n.metadata.LinkTarget)
+	}
+
+	real, err := evalSymlinks(n.FS(), n.metadata.Path)
+	if err != nil {
+		return err
+	}
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if ancestor, err := evalSymlinks(p.FS(), p.metadata.Path); err == nil && ancestor == real {
+			return fmt.Errorf("link loop: %s points back to %s", n.metadata.Path, p.metadata.Path)
+		}
+	}
+	return nil
+}
+
+// SetCacheBudget sets how many nodes the tree keeps loaded before the least
+// recently used directories are unloaded.
+func (e *Engine) SetCacheBudget(nodes int) {
+	e.cache.SetBudget(nodes)
+}
+
+func (e *Engine) CacheStats() CacheStats {
+	return e.cache.Stats()
+}
+func (e *Engine) SetIndex(x *Index) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.index = x
+}
+
+// SetFrecency logs every directory change into f from now on.
+func (e *Engine) SetFrecency(f *Frecency) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.frecency = f
+}
+
+// Frecent returns the visited directories matching query, best first,
+// leaving out the current one.
+func (e *Engine) Frecent(query string, limit int) []FrecencyMatch {
+	e.mu.Lock()
+	f, current := e.frecency, e.current.metadata.Path
+	e.mu.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f.Query(query, current, limit)
+}
+
+// PruneFrecent forgets visited directories that are gone. It stats each of
+// them, so call it off the UI goroutine.
+func (e *Engine) PruneFrecent() {
+	e.mu.Lock()
+	f := e.frecency
+	e.mu.Unlock()
+	if f != nil {
+		f.Prune()
+	}
+}
+
+// visit logs a change into n. Only directories on the local disk are
+// logged, the others cannot be checked for going stale. The caller holds
+// e.mu.
+func (e *Engine) visit(n *Node) {
+	if e.frecency != nil && isLocal(n.FS()) {
+		e.frecency.Add(n.metadata.Path)
+	}
+}
+
+// EnableWatching keeps the directories the user visits up to date with the
+// disk. Changed directories are reported on Changes.
+func (e *Engine) EnableWatching() error {
+	w, err := NewWatcher()
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.watcher = w
+	e.cache.setOnUnload(w.Remove)
+	e.watch(e.current)
+	return nil
+}
+
+// Changes delivers directories whose children changed on disk. It is nil
+// when watching is not enabled.
+func (e *Engine) Changes() <-chan *Node {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.watcher == nil {
+		return nil
+	}
+	return e.watcher.Changes()
+}
+
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, a := range e.archives {
+		a.Close()
+	}
+	e.archives = nil
+	if e.frecency != nil {
+		// losing the last few visits is not worth failing Close for
+		e.frecency.Close()
+	}
+	if e.watcher == nil {
+		return nil
+	}
+	return e.watcher.Close()
+}
+
+// watch starts watching n once it is loaded. Errors, like running out of
+// inotify watches, only mean n is not kept up to date.
+func (e *Engine) watch(n *Node) {
+	if e.watcher != nil && n.metadata.IsDir && isLocal(n.FS()) {
+		e.watcher.Add(n)
+	}
+}
+
 func (e *Engine) ChangeDirectory(node *Node) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.current = node;
+	e.cache.pin(node)
+	e.watch(node)
+	e.visit(node)
 }
 
 func loadChildren(n *Node){
-	if n.loaded || !n.metadata.IsDir {
-		return
+	loadChildrenContext(context.Background(), n)
+}
+
+// loadChildrenContext is loadChildren for directories that may be slow to
+// read. When ctx is done before the read finishes, n is left unloaded and
+// ctx.Err() is returned.
+func loadChildrenContext(ctx context.Context, n *Node) error {
+	if !n.metadata.IsDir {
+		return nil
 	}
-	entries, err := os.ReadDir(n.metadata.Path);
+	// background walkers and the UI may both try to load the same node,
+	// the first one reads it and the others wait for it
+	for {
+		n.mu.Lock()
+		if n.loaded {
+			n.mu.Unlock()
+			if n.cache != nil {
+				n.cache.hit(n)
+			}
+			return nil
+		}
+		wait := n.loading
+		if wait == nil {
+			break
+		}
+		n.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	n.loading = done
+	n.mu.Unlock()
+
+	// reading may be slow, n stays usable meanwhile
+	children, readErr := readChildren(ctx, n)
+
+	n.mu.Lock()
+	n.loading = nil
+	close(done)
+	if err := ctx.Err(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	if readErr != nil {
+		n.err = readErr
+	} else {
+		n.children = children
+	}
+	n.loaded = true
+	count := len(n.children)
+	n.mu.Unlock()
 
-	if err!=nil{
-		n.err = err
-		n.loaded = true
-		return
+	// the cache takes node locks when it evicts, so it is told after unlocking
+	if n.cache != nil {
+		n.cache.miss(n, count)
 	}
-	for _, entry := range entries {
+	return nil
+}
+
+// readChildren reads the entries of n from disk. It does not touch n, the
+// caller stores what it returns. Errors reading n itself are returned; an
+// entry that cannot be stat'ed becomes a failed node. The result is
+// incomplete when ctx is done.
+func readChildren(ctx context.Context, n *Node) ([]*Node, error) {
+	entries, err := readDirContext(ctx, n.FS(), n.metadata.Path);
+	if err != nil {
+		return nil, err
+	}
+	children := []*Node{}
+	for i, entry := range entries {
+		if i%64 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		fileName:=filepath.Join(n.metadata.Path, entry.Name()); 
 		child, err:= NewNode(fileName, n);
 
 		if(err!=nil){
-			panic("The child failled for entry " + entry.Name() )
+			child = newFailedNode(fileName, entry.IsDir(), n, err)
 		}
 
-		n.children = append(n.children, child)
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// readDirContext is readDir, but reads in batches so a huge or slow
+// directory can be given up on when ctx is done.
+func readDirContext(ctx context.Context, fsys FS, path string) ([]fs.DirEntry, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdirent", Path: path, Err: errors.New("not a directory")}
 	}
 
-	n.loaded = true
+	var entries []fs.DirEntry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, err := dir.ReadDir(256)
+		entries = append(entries, batch...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Loaded reports whether the children of n have been read.
+func (n *Node) Loaded() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.loaded
+}
+
+// Load reads the children of n unless they are loaded already, giving up
+// when ctx is done.
+func (e *Engine) Load(ctx context.Context, n *Node) error {
+	return loadChildrenContext(ctx, n)
+}
+
+// Children loads n if needed and returns a snapshot of its children. The
+// slice is never changed in place, so it stays safe to use while watch
+// events patch the tree.
+func (n *Node) Children() []*Node {
+	loadChildren(n)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.children
 }
 
 func (e *Engine) List() ([]*Node, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	loadChildren(e.current)
-	return e.current.children, e.current.err
+	return e.listLocked(), e.current.Err()
+}
+
+// listLocked returns the visible children of the current directory in its
+// sort order. The caller holds e.mu.
+func (e *Engine) listLocked() []*Node {
+	visible, hidden := e.filter.apply(e.current, e.current.Children())
+	e.hidden = hidden
+	return sortNodes(visible, e.sorts.Get(nodeLocation(e.current)))
 }
 
 func (e *Engine) Enter(idx int) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	loadChildren(e.current)
+	children := e.listLocked()
 
-	if idx < 0 || idx >= len(e.current.children) {
+	if idx < 0 || idx >= len(children) {
 		return errors.New("index out of range")
 	}
 
-	n := e.current.children[idx]
-	if !n.metadata.IsDir {
-		return errors.New("not a directory")
+	n := children[idx]
+	if err := checkEnter(n, e.followLinks); err != nil {
+		return err
 	}
 
 	e.current = n
+	e.cache.pin(n)
+	e.watch(n)
+	e.visit(n)
 	return nil
 }
 
 func (e *Engine) Up() error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
-	if e.current.parent == nil {
-		return errors.New("already at root directory")
+	current := e.current
+	e.mu.Unlock()
+	parent, err := e.Parent(current)
+	if err != nil {
+		return err
 	}
-	e.current = e.current.parent
-	return nil
-}
 
-func(e *Engine) Search(query string)([]*Node, error){
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	loadChildren(e.current);
-	var results []*Node
-	// go through current directory and find matching files
+	e.current = parent
+	e.cache.pin(e.current)
+	e.watch(e.current)
+	e.visit(e.current)
+	return nil
+}
 
-	for _, child := range e.current.children {
-			if  containsIgnoreCase(child.metadata.Name, query){
-				results = append(results, child);
-			}
+// Parent returns the directory above n. Above the root it is made on the
+// first call: its entries are read with n itself in place of a new node,
+// so whatever n has loaded stays, and it becomes the new root.
+func (e *Engine) Parent(n *Node) (*Node, error) {
+	if p := n.Parent(); p != nil {
+		return p, nil
+	}
+	path := n.metadata.Path
+	above := filepath.Dir(path)
+	if above == path {
+		return nil, errors.New("already at root directory")
+	}
+	metadata, err := NewNodeMetadataFS(n.FS(), above)
+	if err != nil {
+		return nil, err
+	}
+	parent := &Node{fsys: n.fsys, cache: n.cache, children: []*Node{}, metadata: metadata}
+
+	// nobody else can see parent yet
+	children, err := readChildren(context.Background(), parent)
+	parent.mu.Lock()
+	parent.children, parent.err, parent.loaded = children, err, true
+	if parent.children == nil {
+		parent.children = []*Node{}
+	}
+	idx := -1
+	for i, child := range parent.children {
+		if child.metadata.Path == path {
+			idx = i
 		}
-	return results, nil;
+	}
+	if idx >= 0 {
+		parent.children[idx] = n
+	} else {
+		// an unreadable parent still leads back down
+		parent.children = insertChild(parent.children, n)
+	}
+	count := len(parent.children)
+	parent.mu.Unlock()
+
+	e.mu.Lock()
+	// the cache walks parents when it evicts, so it sees n change too
+	n.mu.Lock()
+	if won := n.parent; won != nil {
+		// another call got here first, its parent is the one in the tree
+		n.mu.Unlock()
+		e.mu.Unlock()
+		return won, nil
+	}
+	if n.cache != nil {
+		n.cache.mu.Lock()
+	}
+	n.parent = parent
+	if n.cache != nil {
+		n.cache.mu.Unlock()
+	}
+	n.mu.Unlock()
+	if e.root == n {
+		e.root = parent
+	}
+	e.mu.Unlock()
+
+	if parent.cache != nil {
+		parent.cache.miss(parent, count)
+	}
+	return parent, nil
 }
 
+// Parent returns the directory n is in, nil for the root.
+func (n *Node) Parent() *Node {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.parent
+}
 
-func containsIgnoreCase(str, substr string) bool {
-	strLower := strings.ToLower(str)
-	substrLower := strings.ToLower(substr)
-	return strings.Contains(strLower, substrLower)
+// Delete removes n from disk, with everything below it, and from the tree.
+// The current directory and its ancestors cannot be deleted.
+func (e *Engine) Delete(n *Node) error {
+	e.mu.Lock()
+	for p := e.current; p != nil; p = p.Parent() {
+		if p == n {
+			e.mu.Unlock()
+			return errors.New("cannot delete the directory you are in")
+		}
+	}
+	e.mu.Unlock()
+	parent := n.Parent()
+	if parent == nil {
+		return errors.New("cannot delete the root")
+	}
+
+	if err := n.FS().RemoveAll(n.metadata.Path); err != nil {
+		// whatever was removed before the error is gone from the tree too
+		if n.metadata.IsDir && n.Loaded() {
+			resyncChildren(n)
+		}
+		resyncChildren(parent)
+		invalidateUsage(n)
+		return err
+	}
+	patchChild(parent, filepath.Base(n.metadata.Path))
+	invalidateUsage(parent)
+	return nil
 }
 
+// patchChild brings the child called name of dir in line with the disk: it
+// is added, replaced or removed. It reports whether anything changed.
+// Directories that are already known keep their Node, so their loaded
+// children and anything pointing at them stay valid.
+func patchChild(dir *Node, name string) bool {
+	path := filepath.Join(dir.metadata.Path, name)
+	metadata, statErr := NewNodeMetadataFS(dir.FS(), path)
+	// an entry that is there but cannot be stat'ed stays, marked as failed
+	var failed *Node
+	if statErr != nil {
+		if info, err := dir.FS().Lstat(path); err == nil {
+			failed = newFailedNode(path, info.IsDir(), dir, statErr)
+		}
+	}
+
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	if !dir.loaded {
+		return false
+	}
+
+	idx := -1
+	for i, child := range dir.children {
+		if child.metadata.Path == path {
+			idx = i
+			break
+		}
+	}
 
+	// copy on write, readers may still hold the old slice
+	children := make([]*Node, 0, len(dir.children)+1)
+	children = append(children, dir.children...)
+	switch {
+	case failed != nil && idx >= 0:
+		children[idx] = failed
+	case failed != nil:
+		children = insertChild(children, failed)
+	case statErr != nil && idx < 0:
+		return false
+	case statErr != nil:
+		children = append(children[:idx], children[idx+1:]...)
+	case idx >= 0 && children[idx].metadata.IsDir && metadata.IsDir && children[idx].err == nil:
+		return false
+	case idx >= 0:
+		children[idx] = &Node{parent: dir, cache: dir.cache, fsys: dir.fsys, children: []*Node{}, metadata: metadata}
+	default:
+		children = insertChild(children, &Node{parent: dir, cache: dir.cache, fsys: dir.fsys, children: []*Node{}, metadata: metadata})
+	}
+	dir.children = children
+	return true
+}
+
+// insertChild adds n to children, keeping the os.ReadDir order, which is
+// sorted by name.
+func insertChild(children []*Node, n *Node) []*Node {
+	pos := sort.Search(len(children), func(i int) bool {
+		return children[i].metadata.Path > n.metadata.Path
+	})
+	children = append(children, nil)
+	copy(children[pos+1:], children[pos:])
+	children[pos] = n
+	return children
+}
 
+// resyncChildren patches every child of dir against the disk, for when
+// individual change events were lost.
+func resyncChildren(dir *Node) bool {
+	names := map[string]bool{}
+	for _, child := range dir.Children() {
+		names[filepath.Base(child.metadata.Path)] = true
+	}
+	if entries, err := readDir(dir.FS(), dir.metadata.Path); err == nil {
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+	}
+	changed := false
+	for name := range names {
+		if patchChild(dir, name) {
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoad_Cancelled(t *testing.T) {
+	fsys, root := makeMemTree(t, "dir/b", "dir/a", "dir/c")
+	engine := newMemEngine(t, fsys, root)
+	dir := engine.current.Children()[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := engine.Load(ctx, dir); err == nil {
+		t.Fatal("expected an error for a cancelled load")
+	}
+	if dir.Loaded() {
+		t.Fatal("a cancelled load must leave the directory unloaded")
+	}
+
+	if err := engine.Load(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	children := dir.Children()
+	if len(children) != 3 {
+		t.Fatalf("got %d children, want 3", len(children))
+	}
+	for i, want := range []string{"a", "b", "c"} {
+		if got := filepath.Base(children[i].metadata.Path); got != want {
+			t.Errorf("child %d = %s, want %s", i, got, want)
+		}
+	}
+}
+
+// blockingFS holds every Open of path until release is closed.
+type blockingFS struct {
+	*MemFS
+	path    string
+	opened  chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	opens   int
+}
+
+func (b *blockingFS) Open(name string) (fs.File, error) {
+	if name == b.path {
+		b.mu.Lock()
+		b.opens++
+		b.mu.Unlock()
+		b.opened <- struct{}{}
+		<-b.release
+	}
+	return b.MemFS.Open(name)
+}
+
+func TestLoad_DoesNotBlockReaders(t *testing.T) {
+	mem, root := makeMemTree(t, "dir/a", "dir/b")
+	fsys := &blockingFS{MemFS: mem, path: filepath.Join(root, "dir"), opened: make(chan struct{}, 2), release: make(chan struct{})}
+	engine := newMemEngine(t, fsys, root)
+	dir := engine.current.Children()[0]
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine.Load(context.Background(), dir)
+		}()
+	}
+	<-fsys.opened
+
+	read := make(chan bool)
+	go func() {
+		dir.Err()
+		read <- dir.Loaded()
+	}()
+	select {
+	case loaded := <-read:
+		if loaded {
+			t.Error("directory counts as loaded while it is read")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the node blocked on the load in progress")
+	}
+
+	close(fsys.release)
+	wg.Wait()
+	if fsys.opens != 1 {
+		t.Errorf("directory was read %d times by concurrent loads, want 1", fsys.opens)
+	}
+	if got := names(dir.Children()); got != "a b" {
+		t.Errorf("children = %q, want a b", got)
+	}
+}
+
+// vanishingFS lists vanish in its directory but fails to stat it, like an
+// entry deleted between reading the directory and stat'ing it.
+type vanishingFS struct {
+	*MemFS
+	vanish string
+}
+
+func (v vanishingFS) Lstat(name string) (fs.FileInfo, error) {
+	if name == v.vanish {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return v.MemFS.Lstat(name)
+}
+
+func TestLoad_KeepsEntriesThatFailToStat(t *testing.T) {
+	mem, root := makeMemTree(t, "ok.txt", "broken")
+	engine := newMemEngine(t, vanishingFS{MemFS: mem, vanish: filepath.Join(root, "broken")}, root)
+
+	children := engine.current.Children()
+	if len(children) != 2 {
+		t.Fatalf("got %d children, want 2", len(children))
+	}
+	broken := children[0]
+	if filepath.Base(broken.metadata.Path) != "broken" {
+		t.Fatalf("first child = %s, want broken", broken.metadata.Path)
+	}
+	if !errors.Is(broken.Err(), fs.ErrNotExist) {
+		t.Errorf("broken link err = %v, want a not-exist error", broken.Err())
+	}
+	if children[1].Err() != nil {
+		t.Errorf("ok.txt has error %v", children[1].Err())
+	}
+	if got := describeErr(broken.Err()); got != "deleted while reading" {
+		t.Errorf("describeErr = %q", got)
+	}
+}
+
+func TestLoad_BrokenSymlink(t *testing.T) {
+	fsys, root := makeMemTree(t, "ok.txt")
+	if err := fsys.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken")); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+
+	children := engine.current.Children()
+	if len(children) != 2 {
+		t.Fatalf("got %d children, want 2", len(children))
+	}
+	broken := children[0]
+	if filepath.Base(broken.metadata.Path) != "broken" {
+		t.Fatalf("first child = %s, want broken", broken.metadata.Path)
+	}
+	meta := broken.metadata
+	if !meta.IsSymlink || !meta.BrokenLink || meta.LinkTarget != filepath.Join(root, "missing") {
+		t.Errorf("broken link metadata = %+v", meta)
+	}
+	if children[1].metadata.IsSymlink || children[1].Err() != nil {
+		t.Errorf("ok.txt metadata = %+v, err %v", children[1].metadata, children[1].Err())
+	}
+}
+
+func TestEnter_Symlinks(t *testing.T) {
+	fsys, root := makeMemTree(t, "real/inner/file.txt")
+	if err := fsys.Symlink("real", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// a link back up the tree, following it would never end
+	if err := fsys.Symlink("..", filepath.Join(root, "real", "inner", "up")); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+
+	link := nodeAt(engine.current, "link")
+	if link == nil || !link.metadata.IsSymlink || !link.metadata.IsDir {
+		t.Fatalf("link = %+v, want a symlinked directory", link)
+	}
+	if err := engine.CanEnter(link); err != nil {
+		t.Errorf("entering link: %v", err)
+	}
+	if got := link.Children(); len(got) != 1 || got[0].metadata.Path != filepath.Join(root, "link", "inner") {
+		t.Errorf("link children = %v, want link/inner", got)
+	}
+
+	up := nodeAt(engine.current, filepath.Join("real", "inner", "up"))
+	if up == nil {
+		t.Fatal("real/inner/up not found")
+	}
+	if err := engine.CanEnter(up); err == nil {
+		t.Error("expected a link loop error")
+	}
+
+	engine.SetFollowSymlinks(false)
+	if err := engine.CanEnter(link); err == nil {
+		t.Error("expected links not to be followed")
+	}
+	if err := engine.CanEnter(nodeAt(engine.current, "real")); err != nil {
+		t.Errorf("entering a plain directory: %v", err)
+	}
+}
+
+func TestWalk_SkipsSymlinkedDirectories(t *testing.T) {
+	fsys, root := makeMemTree(t, "a/b.txt")
+	if err := fsys.Symlink(".", filepath.Join(root, "a", "self")); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+
+	var seen []string
+	var mu sync.Mutex
+	err := walkTree(context.Background(), engine.current, 2, 0, func(n *Node, rel string, depth int) bool {
+		mu.Lock()
+		seen = append(seen, rel)
+		mu.Unlock()
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(seen)
+	want := []string{"a", filepath.Join("a", "b.txt"), filepath.Join("a", "self")}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("walked %v, want %v", seen, want)
+	}
+}
+
+func TestLoad_UnreadableDirectoryKeepsError(t *testing.T) {
+	root := makeTree(t, "file.txt")
+	// a file posing as a directory fails the same way an unreadable one does
+	fake := &Node{metadata: &NodeMetadata{Path: filepath.Join(root, "file.txt"), IsDir: true}}
+	if got := fake.Children(); len(got) != 0 {
+		t.Errorf("got %d children", len(got))
+	}
+	if fake.Err() == nil {
+		t.Error("expected the read error to be kept on the node")
+	}
+}
+
+func TestUp_AboveTheStart(t *testing.T) {
+	fsys, root := makeMemTree(t, "project/sub/file.txt", "sibling/x")
+	start := filepath.Join(root, "project")
+	engine := newMemEngine(t, fsys, start)
+	project := engine.current
+	sub := nodeAt(project, "sub")
+	sub.Children()
+
+	if err := engine.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if engine.current.metadata.Path != root || engine.root != engine.current {
+		t.Fatalf("after up, current = %s", engine.current.metadata.Path)
+	}
+	if got := names(engine.current.Children()); got != "project sibling" {
+		t.Errorf("children = %q", got)
+	}
+	if nodeAt(engine.current, "project") != project || project.Parent() != engine.current {
+		t.Error("the start directory should be reused as a child")
+	}
+	if !sub.Loaded() || nodeAt(engine.current, filepath.Join("project", "sub")) != sub {
+		t.Error("the start directory lost what it had loaded")
+	}
+
+	for engine.Up() == nil {
+	}
+	if engine.current.metadata.Path != string(filepath.Separator) {
+		t.Errorf("stopped going up at %s", engine.current.metadata.Path)
+	}
+
+	other := newMemEngine(t, fsys, start)
+	n, err := other.Resolve(filepath.Join(root, "sibling", "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.parent.parent != other.root || other.root.metadata.Path != root {
+		t.Errorf("resolving above the start gave %s under root %s", n.metadata.Path, other.root.metadata.Path)
+	}
+}
+
+func TestParent_ConcurrentCallsAgree(t *testing.T) {
+	fsys, root := makeMemTree(t, "project/file.txt")
+	engine := newMemEngine(t, fsys, filepath.Join(root, "project"))
+	start := engine.current
+
+	parents := make([]*Node, 8)
+	var wg sync.WaitGroup
+	for i := range parents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := engine.Parent(start)
+			if err != nil {
+				t.Error(err)
+			}
+			parents[i] = p
+		}()
+	}
+	wg.Wait()
+
+	for i, p := range parents {
+		if p != start.Parent() {
+			t.Errorf("call %d returned a parent that is not in the tree", i)
+		}
+	}
+	if engine.root != start.Parent() {
+		t.Error("the root is not the parent in the tree")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// FilterOptions says which entries the file list hides.
+type FilterOptions struct {
+	HideDotfiles bool
+	// HideIgnored hides what .gitignore and .ignore files match
+	HideIgnored bool
+	// HideExcluded hides names matching the exclude list
+	HideExcluded bool
+}
+
+// DefaultFilterOptions hides everything that can be hidden.
+func DefaultFilterOptions() FilterOptions {
+	return FilterOptions{HideDotfiles: true, HideIgnored: true, HideExcluded: true}
+}
+
+// FilterStats counts the entries a listing hid, by the first reason that
+// hid them.
+type FilterStats struct {
+	Dotfiles int
+	Ignored  int
+	Excluded int
+}
+
+// listFilter drops hidden entries from directory listings. It is a layer
+// over Node.children, the tree itself always has every entry.
+type listFilter struct {
+	opts    FilterOptions
+	exclude []string
+	ignores *ignoreSet
+}
+
+func newListFilter() *listFilter {
+	return &listFilter{opts: DefaultFilterOptions(), ignores: newIgnoreSet()}
+}
+
+// excluded reports whether name matches one of the exclude globs.
+func (f *listFilter) excluded(name string) bool {
+	for _, pattern := range f.exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the entries of dir that are not hidden.
+func (f *listFilter) apply(dir *Node, nodes []*Node) ([]*Node, FilterStats) {
+	var stats FilterStats
+	var rules []ignoreRule
+	if f.opts.HideIgnored {
+		rules = f.ignores.rulesFor(dir.FS(), dir.metadata.Path)
+	}
+
+	kept := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		name := filepath.Base(n.metadata.Path)
+		switch {
+		case f.opts.HideExcluded && f.excluded(name):
+			stats.Excluded++
+		case f.opts.HideDotfiles && strings.HasPrefix(name, "."):
+			stats.Dotfiles++
+		case f.opts.HideIgnored && ignored(rules, n.metadata.Path, n.metadata.IsDir):
+			stats.Ignored++
+		default:
+			kept = append(kept, n)
+		}
+	}
+	return kept, stats
+}
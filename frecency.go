@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frecency ranks the directories the user visits by how often and how
+// lately they went there, the way zoxide does, so a few letters are enough
+// to jump back to one.
+type Frecency struct {
+	mu   sync.Mutex
+	path string
+	dirs map[string]*frecencyEntry
+	// now is time.Now, replaced in tests
+	now func() time.Time
+	// dirty is set by changes not saved yet, a save is due when timer fires
+	dirty bool
+	timer *time.Timer
+	// saveMu makes saves write one after the other, in the order they
+	// took their snapshot. It is taken before mu.
+	saveMu sync.Mutex
+}
+
+type frecencyEntry struct {
+	Rank       float64 `json:"rank"`
+	LastAccess int64   `json:"last_access"`
+}
+
+// frecencyMaxAge is the total rank kept. Going over it ages every entry,
+// and those that fall below a single visit are forgotten.
+const frecencyMaxAge = 10000
+
+// frecencySaveDelay is how long changes are collected before they are
+// written, so walking through a few directories writes the file once.
+const frecencySaveDelay = 2 * time.Second
+
+// FrecencyMatch is a directory that matched a query, with its score.
+type FrecencyMatch struct {
+	Path  string
+	Score float64
+}
+
+func DefaultFrecencyPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "frecency.json"), nil
+}
+
+// OpenFrecency loads the visits stored at path. A missing or broken file
+// gives no history; an empty path keeps it in memory only.
+func OpenFrecency(path string) *Frecency {
+	f := &Frecency{path: path, dirs: map[string]*frecencyEntry{}, now: time.Now}
+	if path == "" {
+		return f
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f
+	}
+	var dirs map[string]*frecencyEntry
+	if json.Unmarshal(data, &dirs) == nil && dirs != nil {
+		f.dirs = dirs
+	}
+	return f
+}
+
+// Add records a visit to dir. It is saved a little later in the
+// background, or on Close.
+func (f *Frecency) Add(dir string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.dirs[dir]
+	if !ok {
+		e = &frecencyEntry{}
+		f.dirs[dir] = e
+	}
+	e.Rank++
+	e.LastAccess = f.now().Unix()
+	f.age()
+	f.changed()
+}
+
+// changed schedules a save. The caller holds f.mu.
+func (f *Frecency) changed() {
+	f.dirty = true
+	if f.timer == nil && f.path != "" {
+		f.timer = time.AfterFunc(frecencySaveDelay, func() { f.Save() })
+	}
+}
+
+// Save writes the changes made so far, if any. Changes that fail to be
+// written stay due for the next save.
+func (f *Frecency) Save() error {
+	f.saveMu.Lock()
+	defer f.saveMu.Unlock()
+
+	f.mu.Lock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if !f.dirty || f.path == "" {
+		f.mu.Unlock()
+		return nil
+	}
+	// visits made while writing set it again
+	f.dirty = false
+	data, err := json.Marshal(f.dirs)
+	f.mu.Unlock()
+	if err == nil {
+		err = writeFileAtomic(f.path, data)
+	}
+	if err != nil {
+		f.mu.Lock()
+		f.dirty = true
+		f.mu.Unlock()
+	}
+	return err
+}
+
+// Close saves what is not saved yet.
+func (f *Frecency) Close() error {
+	return f.Save()
+}
+
+// Prune forgets directories that are gone. It stats every one of them, so
+// it is meant to run in the background.
+func (f *Frecency) Prune() {
+	f.mu.Lock()
+	dirs := make([]string, 0, len(f.dirs))
+	for dir := range f.dirs {
+		dirs = append(dirs, dir)
+	}
+	f.mu.Unlock()
+
+	var stale []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			stale = append(stale, dir)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, dir := range stale {
+		delete(f.dirs, dir)
+	}
+	f.changed()
+}
+
+// age scales all ranks down once their total passes frecencyMaxAge. The
+// caller holds f.mu.
+func (f *Frecency) age() {
+	var total float64
+	for _, e := range f.dirs {
+		total += e.Rank
+	}
+	if total <= frecencyMaxAge {
+		return
+	}
+	factor := 0.9 * frecencyMaxAge / total
+	for dir, e := range f.dirs {
+		e.Rank *= factor
+		if e.Rank < 1 {
+			delete(f.dirs, dir)
+		}
+	}
+}
+
+// score weighs the rank of e by how long ago it was last visited.
+func (f *Frecency) score(e *frecencyEntry, now time.Time) float64 {
+	switch elapsed := now.Sub(time.Unix(e.LastAccess, 0)); {
+	case elapsed < time.Hour:
+		return e.Rank * 4
+	case elapsed < 24*time.Hour:
+		return e.Rank * 2
+	case elapsed < 7*24*time.Hour:
+		return e.Rank / 2
+	default:
+		return e.Rank / 4
+	}
+}
+
+// Query returns up to limit directories matching query, best first. Each
+// word of the query has to fuzzy match the path and the last one its final
+// element, so "mod" finds /root/module but not /root/module/src. It does
+// not touch the disk; directories that are gone are left to Prune.
+func (f *Frecency) Query(query, exclude string, limit int) []FrecencyMatch {
+	words := strings.Fields(query)
+	f.mu.Lock()
+	now := f.now()
+	var matches []FrecencyMatch
+	for dir, e := range f.dirs {
+		if dir != exclude && frecencyMatches(dir, words) {
+			matches = append(matches, FrecencyMatch{Path: dir, Score: f.score(e, now)})
+		}
+	}
+	f.mu.Unlock()
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+func frecencyMatches(dir string, words []string) bool {
+	if len(words) == 0 {
+		return true
+	}
+	for _, w := range words {
+		if _, _, ok := matchName(dir, w, true); !ok {
+			return false
+		}
+	}
+	_, _, ok := matchName(filepath.Base(dir), words[len(words)-1], true)
+	return ok
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func frecentPaths(matches []FrecencyMatch) []string {
+	var paths []string
+	for _, m := range matches {
+		paths = append(paths, m.Path)
+	}
+	return paths
+}
+
+func TestFrecency_FuzzyMatch(t *testing.T) {
+	root := makeTree(t, "module/src/x.go", "mode/x", "docs/modern/x")
+	f := OpenFrecency("")
+	for _, dir := range []string{"module", "module/src", "mode", "docs/modern", "docs"} {
+		f.Add(filepath.Join(root, dir))
+	}
+	f.Add(filepath.Join(root, "module"))
+
+	got := frecentPaths(f.Query("mod", "", 10))
+	if len(got) != 3 || got[0] != filepath.Join(root, "module") {
+		t.Fatalf("Query(mod) = %v, want module first of three", got)
+	}
+	for _, p := range got {
+		if p == filepath.Join(root, "module", "src") {
+			t.Errorf("Query(mod) matched %s, the last word has to match the last element", p)
+		}
+	}
+
+	got = frecentPaths(f.Query("docs mod", "", 10))
+	if len(got) != 1 || got[0] != filepath.Join(root, "docs", "modern") {
+		t.Errorf("Query(docs mod) = %v, want docs/modern", got)
+	}
+
+	got = frecentPaths(f.Query("mod", filepath.Join(root, "module"), 10))
+	if len(got) == 0 || got[0] == filepath.Join(root, "module") {
+		t.Errorf("Query(mod) = %v, want the excluded directory left out", got)
+	}
+}
+
+func TestFrecency_RecentBeatsOld(t *testing.T) {
+	root := makeTree(t, "old/x", "new/x")
+	now := time.Now()
+	f := OpenFrecency("")
+	f.now = func() time.Time { return now.Add(-30 * 24 * time.Hour) }
+	for range 5 {
+		f.Add(filepath.Join(root, "old"))
+	}
+	f.now = func() time.Time { return now }
+	f.Add(filepath.Join(root, "new"))
+
+	// 5 visits a month ago score 1.25, one just now scores 4
+	got := frecentPaths(f.Query("", "", 10))
+	if len(got) != 2 || got[0] != filepath.Join(root, "new") {
+		t.Errorf("Query() = %v, want the recent directory first", got)
+	}
+}
+
+func TestFrecency_PrunesStale(t *testing.T) {
+	root := makeTree(t, "keep/x", "gone/x")
+	path := filepath.Join(t.TempDir(), "frecency.json")
+	f := OpenFrecency(path)
+	f.Add(filepath.Join(root, "keep"))
+	f.Add(filepath.Join(root, "gone"))
+	if err := os.RemoveAll(filepath.Join(root, "gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	// queries do not stat, pruning does
+	if got := f.Query("", "", 10); len(got) != 2 {
+		t.Errorf("Query() = %v before pruning, want both", frecentPaths(got))
+	}
+	f.Prune()
+	if got := frecentPaths(f.Query("", "", 10)); len(got) != 1 || got[0] != filepath.Join(root, "keep") {
+		t.Errorf("Query() = %v, want only keep", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := OpenFrecency(path)
+	if _, ok := reopened.dirs[filepath.Join(root, "gone")]; ok {
+		t.Error("stale directory is still in the saved history")
+	}
+	if _, ok := reopened.dirs[filepath.Join(root, "keep")]; !ok {
+		t.Error("visited directory was not saved")
+	}
+}
+
+func TestFrecency_SavesLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frecency.json")
+	f := OpenFrecency(path)
+	f.Add("/a")
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("a visit was written straight away")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := OpenFrecency(path).dirs["/a"]; !ok {
+		t.Error("visit was not saved on Close")
+	}
+}
+
+func TestFrecency_RetriesFailedSave(t *testing.T) {
+	dir := t.TempDir()
+	// a file where the directory should be makes the write fail
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := OpenFrecency(filepath.Join(blocker, "frecency.json"))
+	f.Add("/a")
+	if err := f.Save(); err == nil {
+		t.Fatal("save into a file succeeded")
+	}
+
+	f.path = filepath.Join(dir, "frecency.json")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := OpenFrecency(f.path).dirs["/a"]; !ok {
+		t.Error("visit was dropped after a failed save")
+	}
+}
+
+func TestFrecency_Aging(t *testing.T) {
+	f := OpenFrecency("")
+	f.dirs["/rare"] = &frecencyEntry{Rank: 1}
+	f.dirs["/busy"] = &frecencyEntry{Rank: frecencyMaxAge}
+	f.Add("/busy")
+
+	if _, ok := f.dirs["/rare"]; ok {
+		t.Error("a directory aged below one visit was kept")
+	}
+	if rank := f.dirs["/busy"].Rank; rank >= frecencyMaxAge {
+		t.Errorf("rank = %v, want it aged below %d", rank, frecencyMaxAge)
+	}
+}
+
+func TestEngine_LogsVisits(t *testing.T) {
+	root := makeTree(t, "a/b/x")
+	engine := NewEngine(root)
+	f := OpenFrecency("")
+	engine.SetFrecency(f)
+
+	if err := engine.Enter(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Enter(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Up(); err != nil {
+		t.Fatal(err)
+	}
+	engine.ChangeDirectory(engine.root)
+
+	want := map[string]float64{
+		filepath.Join(root, "a"):      2,
+		filepath.Join(root, "a", "b"): 1,
+		root:                          1,
+	}
+	for dir, rank := range want {
+		if e, ok := f.dirs[dir]; !ok || e.Rank != rank {
+			t.Errorf("%s logged %v, want rank %v", dir, e, rank)
+		}
+	}
+	if got := frecentPaths(engine.Frecent("b", 10)); len(got) != 1 || got[0] != filepath.Join(root, "a", "b") {
+		t.Errorf("Frecent(b) = %v, want a/b", got)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// files with a NUL byte in their first binarySniffLen bytes are binary
+	binarySniffLen = 8000
+	// grepMaxFileSize keeps the content search away from huge files
+	grepMaxFileSize = 32 << 20
+	// lines longer than this are skipped, they are rarely worth a snippet
+	grepMaxLineLen = 1 << 20
+
+	snippetLen     = 120
+	snippetContext = 40
+)
+
+// GrepHit is a single line that matched a content search.
+type GrepHit struct {
+	Node    *Node
+	RelPath string
+	Line    int // 1 based
+	Snippet string
+	// Matches holds the rune positions in Snippet that matched the pattern.
+	Matches []int
+}
+
+// compileGrepPattern turns a content search pattern into a regexp. A
+// pattern wrapped in slashes is a regular expression, anything else is
+// matched literally. Both are case insensitive unless they contain an
+// upper case letter.
+func compileGrepPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+	expr := regexp.QuoteMeta(pattern)
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	}
+	if strings.IndexFunc(pattern, unicode.IsUpper) < 0 {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %v", err)
+	}
+	return re, nil
+}
+
+// Grep searches the contents of the files in the current directory, or the
+// whole subtree when opts.Recursive is set, and sends every matching line on
+// hits as soon as it is found. Binary files are skipped. The caller owns hits
+// and should close it once Grep returns.
+func (e *Engine) Grep(ctx context.Context, pattern string, opts SearchOptions, hits chan<- GrepHit) error {
+	re, err := compileGrepPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	root := e.current
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	maxDepth := opts.MaxDepth
+	if !opts.Recursive {
+		maxDepth = 1
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	// the walker feeds files to a separate pool so a directory full of
+	// large files does not hold up the rest of the tree
+	files := make(chan walkJob)
+	var walkErr error
+	go func() {
+		walkErr = walkTree(ctx, root, workers, maxDepth, func(n *Node, rel string, depth int) bool {
+			if !n.metadata.IsDir {
+				select {
+				case files <- walkJob{node: n, rel: rel, depth: depth}:
+				case <-ctx.Done():
+				}
+			}
+			return true
+		})
+		close(files)
+	}()
+
+	var (
+		count int64
+		wg    sync.WaitGroup
+	)
+	emit := func(hit GrepHit) bool {
+		n := atomic.AddInt64(&count, 1)
+		if opts.Limit > 0 && n > int64(opts.Limit) {
+			cancel()
+			return false
+		}
+		select {
+		case hits <- hit:
+		case <-ctx.Done():
+			return false
+		}
+		if opts.Limit > 0 && n == int64(opts.Limit) {
+			cancel()
+		}
+		return true
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range files {
+				grepFile(ctx, re, job, emit)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if opts.Limit > 0 && atomic.LoadInt64(&count) >= int64(opts.Limit) {
+		return nil
+	}
+	return walkErr
+}
+
+// grepFile scans one file line by line and hands every match to emit until
+// emit returns false. Unreadable, binary and oversized files are skipped.
+func grepFile(ctx context.Context, re *regexp.Regexp, job walkJob, emit func(GrepHit) bool) {
+	if job.node.metadata.Size > grepMaxFileSize {
+		return
+	}
+	f, err := job.node.FS().Open(job.node.metadata.Path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return
+	}
+	head = head[:n]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return
+	}
+
+	r := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(head), f), 64*1024)
+	for line := 1; ; line++ {
+		if line%256 == 0 && ctx.Err() != nil {
+			return
+		}
+		data, tooLong, err := readLine(r, grepMaxLineLen)
+		if err != nil {
+			return
+		}
+		if tooLong {
+			continue
+		}
+		text := string(data)
+		loc := re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		snippet, matches := makeSnippet(text, loc[0], loc[1])
+		hit := GrepHit{
+			Node:    job.node,
+			RelPath: job.rel,
+			Line:    line,
+			Snippet: snippet,
+			Matches: matches,
+		}
+		if !emit(hit) {
+			return
+		}
+	}
+}
+
+// readLine reads the next line from r without its line ending. A line
+// longer than max bytes is read past but not kept, tooLong says so.
+func readLine(r *bufio.Reader, max int) (line []byte, tooLong bool, err error) {
+	read := 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		read += len(chunk)
+		switch {
+		case tooLong:
+		case len(line)+len(chunk) > max+1:
+			// max does not count the newline
+			line, tooLong = nil, true
+		default:
+			line = append(line, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && read > 0 {
+			err = nil
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		return line, tooLong, err
+	}
+}
+
+// makeSnippet cuts a window of at most snippetLen runes out of line around
+// the match at the byte range [start, end) and returns it together with the
+// rune positions of the match inside the window.
+func makeSnippet(line string, start, end int) (string, []int) {
+	runes := []rune(strings.ReplaceAll(line, "\t", " "))
+	matchStart := utf8.RuneCountInString(line[:start])
+	matchEnd := utf8.RuneCountInString(line[:end])
+
+	// drop indentation, unless the match is in it
+	from := 0
+	for from < matchStart && unicode.IsSpace(runes[from]) {
+		from++
+	}
+	if matchStart-from > snippetContext {
+		from = matchStart - snippetContext
+	}
+	to := min(len(runes), from+snippetLen)
+
+	var matches []int
+	for i := matchStart; i < matchEnd && i < to; i++ {
+		matches = append(matches, i-from)
+	}
+	return string(runes[from:to]), matches
+}
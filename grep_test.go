@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func collectHits(t *testing.T, engine *Engine, pattern string, opts SearchOptions) []GrepHit {
+	t.Helper()
+	hits := make(chan GrepHit)
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.Grep(context.Background(), pattern, opts, hits)
+		close(hits)
+	}()
+	var all []GrepHit
+	for hit := range hits {
+		all = append(all, hit)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].RelPath != all[j].RelPath {
+			return all[i].RelPath < all[j].RelPath
+		}
+		return all[i].Line < all[j].Line
+	})
+	return all
+}
+
+func TestGrep_LiteralAndLines(t *testing.T) {
+	fsys, root := makeMemTree(t)
+	fsys.WriteFile(filepath.Join(root, "a.txt"), []byte("one\n\tTODO: fix (this)\nthree todo\n"), 0644)
+	fsys.Mkdir(filepath.Join(root, "sub"), 0755)
+	fsys.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("nothing\ntodo again\n"), 0644)
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	hits := collectHits(t, engine, "todo", opts)
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits in the current folder, want 2", len(hits))
+	}
+	if hits[0].Line != 2 || hits[0].Snippet != "TODO: fix (this)" {
+		t.Errorf("first hit = line %d %q", hits[0].Line, hits[0].Snippet)
+	}
+	if len(hits[0].Matches) != 4 || hits[0].Matches[0] != 0 {
+		t.Errorf("matches = %v, want [0 1 2 3]", hits[0].Matches)
+	}
+
+	opts.Recursive = true
+	if hits := collectHits(t, engine, "todo", opts); len(hits) != 3 {
+		t.Errorf("got %d hits recursively, want 3", len(hits))
+	}
+
+	// upper case makes the search case sensitive, parentheses are literal
+	if hits := collectHits(t, engine, "TODO: fix (", opts); len(hits) != 1 {
+		t.Errorf("got %d hits for a literal pattern, want 1", len(hits))
+	}
+}
+
+func TestGrep_RegexAndBinary(t *testing.T) {
+	fsys, root := makeMemTree(t)
+	fsys.WriteFile(filepath.Join(root, "code.go"), []byte("func main() {}\nfunc helper() {}\n"), 0644)
+	fsys.WriteFile(filepath.Join(root, "blob.bin"), []byte("func main\x00\x01\x02"), 0644)
+	engine := newMemEngine(t, fsys, root)
+
+	hits := collectHits(t, engine, `/^func \w+\(/`, DefaultSearchOptions())
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits, want 2 (binary file must be skipped)", len(hits))
+	}
+	for _, hit := range hits {
+		if hit.RelPath != "code.go" {
+			t.Errorf("unexpected hit in %s", hit.RelPath)
+		}
+	}
+}
+
+func TestGrep_Limit(t *testing.T) {
+	fsys, root := makeMemTree(t)
+	fsys.WriteFile(filepath.Join(root, "many.txt"), []byte("x\nx\nx\nx\nx\n"), 0644)
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Limit = 2
+	if hits := collectHits(t, engine, "x", opts); len(hits) != 2 {
+		t.Errorf("got %d hits, want 2", len(hits))
+	}
+}
+
+func TestGrep_SkipsLongLines(t *testing.T) {
+	fsys, root := makeMemTree(t)
+	long := strings.Repeat("todo ", grepMaxLineLen/4)
+	fsys.WriteFile(filepath.Join(root, "a.txt"), []byte("first todo\r\n"+long+"\nlast todo"), 0644)
+	engine := newMemEngine(t, fsys, root)
+
+	hits := collectHits(t, engine, "todo", DefaultSearchOptions())
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits, want the lines around the long one", len(hits))
+	}
+	if hits[0].Line != 1 || hits[0].Snippet != "first todo" || hits[1].Line != 3 || hits[1].Snippet != "last todo" {
+		t.Errorf("hits = line %d %q, line %d %q", hits[0].Line, hits[0].Snippet, hits[1].Line, hits[1].Snippet)
+	}
+}
+
+func TestCompileGrepPattern_Errors(t *testing.T) {
+	for _, p := range []string{"", "/[/"} {
+		if _, err := compileGrepPattern(p); err == nil {
+			t.Errorf("compileGrepPattern(%q) succeeded, want an error", p)
+		}
+	}
+}
+
+func TestEditorLineArgs(t *testing.T) {
+	if got := editorLineArgs("/usr/bin/nvim", "f.go", 12); got[0] != "+12" || got[1] != "f.go" {
+		t.Errorf("nvim args = %v", got)
+	}
+	if got := editorLineArgs("code", "f.go", 12); got[0] != "-g" || got[1] != "f.go:12" {
+		t.Errorf("code args = %v", got)
+	}
+}
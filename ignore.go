@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoreFiles are read in every directory, later files take precedence.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// base is the directory of the file the rule came from, patterns match
+	// paths relative to it
+	base string
+}
+
+// parseIgnoreLine turns a line of a .gitignore file into a rule. Blank lines
+// and comments give ok == false.
+func parseIgnoreLine(line, base string) (rule ignoreRule, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are dropped unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	rule.base = base
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+
+	// a slash anywhere but the end anchors the pattern to base
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "(^|/)" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globToRegexp translates gitignore glob syntax. * and ? never match a
+// slash, ** matches across directories.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match reports whether the rule applies to path. rel is path relative to
+// rule.base, using forward slashes.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(rel)
+}
+
+// ignoreSet caches the rules of every directory it has been asked about.
+// Entries are reread when the ignore files change. The rules that apply
+// inside a directory are cached too, so listing it again reads nothing
+// until forget says it changed.
+type ignoreSet struct {
+	mu     sync.Mutex
+	dirs   map[string]*dirRules
+	chains map[string][]ignoreRule
+}
+
+type dirRules struct {
+	mtimes []time.Time
+	rules  []ignoreRule
+}
+
+func newIgnoreSet() *ignoreSet {
+	return &ignoreSet{dirs: map[string]*dirRules{}, chains: map[string][]ignoreRule{}}
+}
+
+// rulesFor returns the rules that apply inside dir, from the top of its git
+// repository, or the filesystem root outside one, down to dir itself. Off
+// the local disk every ancestor costs a round trip, so there only the
+// ignore files of dir itself count.
+func (s *ignoreSet) rulesFor(fsys FS, dir string) []ignoreRule {
+	s.mu.Lock()
+	rules, ok := s.chains[dir]
+	s.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	chain := []string{dir}
+	for d := dir; isLocal(fsys); d = filepath.Dir(d) {
+		if _, err := fsys.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+		chain = append(chain, filepath.Dir(d))
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		rules = append(rules, s.dirRules(fsys, chain[i])...)
+	}
+	s.mu.Lock()
+	s.chains[dir] = rules
+	s.mu.Unlock()
+	return rules
+}
+
+// forget drops what is cached about dir and the rules of everything below
+// it, for when its entries, and so maybe its ignore files, changed.
+func (s *ignoreSet) forget(dir string) {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dirs, dir)
+	for d := range s.chains {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(s.chains, d)
+		}
+	}
+}
+
+// reset drops everything cached.
+func (s *ignoreSet) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs = map[string]*dirRules{}
+	s.chains = map[string][]ignoreRule{}
+}
+
+func (s *ignoreSet) dirRules(fsys FS, dir string) []ignoreRule {
+	mtimes := make([]time.Time, len(ignoreFiles))
+	for i, name := range ignoreFiles {
+		if info, err := fsys.Stat(filepath.Join(dir, name)); err == nil {
+			mtimes[i] = info.ModTime()
+		}
+	}
+
+	s.mu.Lock()
+	cached, ok := s.dirs[dir]
+	s.mu.Unlock()
+	if ok && sameTimes(cached.mtimes, mtimes) {
+		return cached.rules
+	}
+
+	var rules []ignoreRule
+	for i, name := range ignoreFiles {
+		if mtimes[i].IsZero() {
+			continue
+		}
+		rules = append(rules, readIgnoreFile(fsys, filepath.Join(dir, name), dir)...)
+	}
+	s.mu.Lock()
+	s.dirs[dir] = &dirRules{mtimes: mtimes, rules: rules}
+	s.mu.Unlock()
+	return rules
+}
+
+func sameTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func readIgnoreFile(fsys FS, path, base string) []ignoreRule {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ignored reports whether path is ignored by rules. As in git, a path inside
+// an ignored directory is ignored whatever later rules say about it.
+func ignored(rules []ignoreRule, path string, isDir bool) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	top := rules[0].base
+	rel, err := filepath.Rel(top, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i < len(parts); i++ {
+		if ignoredSelf(rules, filepath.Join(top, filepath.Join(parts[:i]...)), true) {
+			return true
+		}
+	}
+	return ignoredSelf(rules, path, isDir)
+}
+
+// ignoredSelf applies the rules to path alone, the last matching rule wins.
+func ignoredSelf(rules []ignoreRule, path string, isDir bool) bool {
+	result := false
+	for _, r := range rules {
+		rel, err := filepath.Rel(r.base, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if r.match(filepath.ToSlash(rel), isDir) {
+			result = !r.negate
+		}
+	}
+	return result
+}
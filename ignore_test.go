@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	base := "/repo"
+	rules := []ignoreRule{}
+	for _, line := range []string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/top.txt",
+		"docs/**/*.tmp",
+		"cache/**",
+		`\#hash`,
+		"[ab].o",
+	} {
+		if rule, ok := parseIgnoreLine(line, base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) != 8 {
+		t.Fatalf("parsed %d rules, want 8", len(rules))
+	}
+
+	for _, tc := range []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/repo/a.log", false, true},
+		{"/repo/sub/b.log", false, true},
+		{"/repo/keep.log", false, false},
+		{"/repo/build", true, true},
+		{"/repo/build", false, false},
+		{"/repo/src/build", true, true},
+		{"/repo/build/out.bin", false, true},
+		{"/repo/top.txt", false, true},
+		{"/repo/sub/top.txt", false, false},
+		{"/repo/docs/a/b/c.tmp", false, true},
+		{"/repo/docs/c.tmp", false, true},
+		{"/repo/c.tmp", false, false},
+		{"/repo/cache/x/y", false, true},
+		{"/repo/cache", true, false},
+		{"/repo/#hash", false, true},
+		{"/repo/a.o", false, true},
+		{"/repo/c.o", false, false},
+		{"/elsewhere/a.log", false, false},
+	} {
+		if got := ignored(rules, tc.path, tc.isDir); got != tc.want {
+			t.Errorf("ignored(%s, dir=%v) = %v, want %v", tc.path, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+func TestEngine_ListFilters(t *testing.T) {
+	fsys, root := makeMemTree(t,
+		".hidden", "visible.txt", "debug.log", "node_modules/x/index.js",
+		"sub/.ignore", "sub/a.go", "sub/gen.go", "sub/keep.log",
+	)
+	fsys.Mkdir(filepath.Join(root, ".git"), 0755)
+	if err := fsys.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(filepath.Join(root, "sub", ".ignore"), []byte("gen.go\n!keep.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+	engine.SetExclude([]string{"node_modules"})
+
+	list, _ := engine.List()
+	if got := names(list); got != "sub visible.txt" {
+		t.Errorf("list = %q", got)
+	}
+	if got, want := engine.Hidden(), (FilterStats{Dotfiles: 3, Ignored: 1, Excluded: 1}); got != want {
+		t.Errorf("hidden = %+v, want %+v", got, want)
+	}
+
+	engine.SetFilter(FilterOptions{HideExcluded: true})
+	list, _ = engine.List()
+	if got := names(list); got != ".git sub .gitignore .hidden debug.log visible.txt" {
+		t.Errorf("with dotfiles and ignored shown, list = %q", got)
+	}
+
+	engine.SetFilter(DefaultFilterOptions())
+	if err := engine.Enter(0); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = engine.List()
+	if got := names(list); got != "a.go keep.log" {
+		t.Errorf("sub list = %q", got)
+	}
+}
+
+func TestEngine_IgnoreRulesCachedUntilChanged(t *testing.T) {
+	fsys, root := makeMemTree(t, "a.log", "b.txt")
+	if err := fsys.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := newMemEngine(t, fsys, root)
+
+	list, _ := engine.List()
+	if got := names(list); got != "b.txt" {
+		t.Fatalf("list = %q", got)
+	}
+	if err := fsys.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = engine.List()
+	if got := names(list); got != "b.txt" {
+		t.Errorf("list = %q before the change was reported, want the cached rules", got)
+	}
+
+	engine.DirChanged(engine.current)
+	list, _ = engine.List()
+	if got := names(list); got != "a.log" {
+		t.Errorf("list = %q after the change, want the new rules", got)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexMaxAge is how long an index is trusted after its last update.
+const IndexMaxAge = time.Hour
+
+// Index is a persistent record of the names and metadata of every entry
+// below a set of root directories. It lets recursive searches skip walking
+// the disk. Updates are incremental: a directory whose mtime did not change
+// keeps its recorded entries without being read again.
+type Index struct {
+	mu sync.RWMutex
+
+	path     string
+	roots    []string
+	dirs     map[string]*indexDir
+	updated  time.Time
+	building bool
+	err      error
+}
+
+type indexDir struct {
+	ModTime int64
+	Entries []indexEntry
+}
+
+type indexEntry struct {
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime int64
+}
+
+// indexFile is what we write to disk, gob encoded and gzipped.
+type indexFile struct {
+	Roots   []string
+	Updated time.Time
+	Dirs    map[string]*indexDir
+}
+
+// IndexStatus is a snapshot of the index for display.
+type IndexStatus struct {
+	Path     string
+	Roots    []string
+	Dirs     int
+	Entries  int
+	Updated  time.Time
+	Building bool
+	Err      error
+}
+
+func DefaultIndexPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "index.gob.gz"), nil
+}
+
+// OpenIndex loads the index stored at path. A missing or unreadable file
+// gives an empty index that needs an update before it is used. Records for
+// directories outside roots are dropped on the next update.
+func OpenIndex(path string, roots []string) *Index {
+	x := &Index{
+		path:  path,
+		roots: roots,
+		dirs:  map[string]*indexDir{},
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return x
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return x
+	}
+	var stored indexFile
+	if err := gob.NewDecoder(zr).Decode(&stored); err != nil {
+		return x
+	}
+	if stored.Dirs != nil {
+		x.dirs = stored.Dirs
+	}
+	// an index built for other roots does not tell us anything fresh
+	if sameRoots(stored.Roots, roots) {
+		x.updated = stored.Updated
+	}
+	return x
+}
+
+func sameRoots(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns a snapshot of the index.
+func (x *Index) Status() IndexStatus {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	st := IndexStatus{
+		Path:     x.path,
+		Roots:    x.roots,
+		Dirs:     len(x.dirs),
+		Updated:  x.updated,
+		Building: x.building,
+		Err:      x.err,
+	}
+	for _, d := range x.dirs {
+		st.Entries += len(d.Entries)
+	}
+	return st
+}
+
+// Stale reports whether the index is due for an update.
+func (x *Index) Stale() bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return time.Since(x.updated) > IndexMaxAge
+}
+
+// Fresh reports whether the index can answer a search below path: it covers
+// path, is not too old, and none of the directories recorded below path
+// has changed since. The directories are checked without holding the lock.
+func (x *Index) Fresh(path string) bool {
+	x.mu.RLock()
+	if x.building || time.Since(x.updated) > IndexMaxAge {
+		x.mu.RUnlock()
+		return false
+	}
+	if _, ok := x.dirs[path]; !ok {
+		x.mu.RUnlock()
+		return false
+	}
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+	recorded := map[string]int64{}
+	for dir, d := range x.dirs {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			recorded[dir] = d.ModTime
+		}
+	}
+	x.mu.RUnlock()
+
+	for dir, mtime := range recorded {
+		info, err := os.Stat(dir)
+		if err != nil || info.ModTime().UnixNano() != mtime {
+			return false
+		}
+	}
+	return true
+}
+
+// Update brings the index up to date with the disk and saves it. Unless
+// full is set, directories whose mtime is unchanged are not read again.
+func (x *Index) Update(ctx context.Context, full bool, workers int) error {
+	x.mu.Lock()
+	if x.building {
+		x.mu.Unlock()
+		return errors.New("index update already running")
+	}
+	x.building = true
+	old := x.dirs
+	roots := x.roots
+	x.mu.Unlock()
+
+	var mu sync.Mutex
+	dirs := map[string]*indexDir{}
+	err := runQueue(ctx, workers, roots, func(dir string) []string {
+		d, subdirs := scanIndexDir(dir, old[dir], full)
+		if d == nil {
+			return nil
+		}
+		mu.Lock()
+		dirs[dir] = d
+		mu.Unlock()
+		return subdirs
+	})
+
+	x.mu.Lock()
+	x.building = false
+	if err == nil {
+		x.dirs = dirs
+		x.updated = time.Now()
+	}
+	x.err = err
+	x.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return x.Save()
+}
+
+// scanIndexDir records one directory, reusing prev when the directory has
+// not changed. It returns the record and the subdirectories to scan next.
+func scanIndexDir(dir string, prev *indexDir, full bool) (*indexDir, []string) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	mtime := info.ModTime().UnixNano()
+
+	d := prev
+	if full || prev == nil || prev.ModTime != mtime {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil
+		}
+		d = &indexDir{ModTime: mtime, Entries: make([]indexEntry, 0, len(entries))}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			d.Entries = append(d.Entries, indexEntry{
+				Name:    entry.Name(),
+				IsDir:   entry.IsDir(),
+				Size:    info.Size(),
+				ModTime: info.ModTime().UnixNano(),
+			})
+		}
+	}
+
+	var subdirs []string
+	for _, e := range d.Entries {
+		if e.IsDir {
+			subdirs = append(subdirs, filepath.Join(dir, e.Name))
+		}
+	}
+	return d, subdirs
+}
+
+// Save writes the index to disk, replacing the old file atomically.
+func (x *Index) Save() error {
+	x.mu.RLock()
+	stored := indexFile{Roots: x.roots, Updated: x.updated, Dirs: x.dirs}
+	x.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := gob.NewEncoder(zw).Encode(&stored); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), x.path)
+}
+
+// indexHit is an index entry that matched a search, not yet resolved to a Node
+type indexHit struct {
+	rel     string
+	score   int
+	matches []int
+}
+
+// search returns the entries below root that match q, at most maxDepth
+// levels deep. Entries the query needs a fresh size or mtime for are
+// stat'ed after the lock is released.
+func (x *Index) search(ctx context.Context, root string, q *Query, opts SearchOptions, now time.Time) ([]indexHit, error) {
+	hits, unsure, err := x.match(ctx, root, q, opts, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range unsure {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// the query looks at what may be stale, ask the disk
+		meta, err := NewNodeMetadata(u.path)
+		if err != nil {
+			continue
+		}
+		if score, matches, ok := q.Match(meta, u.name, opts.Fuzzy, now); ok {
+			hits = append(hits, indexHit{rel: u.rel, score: score, matches: matches})
+		}
+	}
+	return hits, nil
+}
+
+// unsureHit is an index entry whose match depends on its current metadata
+type unsureHit struct {
+	path string
+	name string
+	rel  string
+}
+
+// match goes through the recorded entries below root under the lock. It
+// returns the ones that match q, and the ones only the disk can decide.
+func (x *Index) match(ctx context.Context, root string, q *Query, opts SearchOptions, now time.Time) ([]indexHit, []unsureHit, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var hits []indexHit
+	var unsure []unsureHit
+	prefix := strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator)
+	for dir, d := range x.dirs {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		var relDir string
+		if dir != root {
+			if !strings.HasPrefix(dir, prefix) {
+				continue
+			}
+			relDir = dir[len(prefix):]
+		}
+		depth := 1
+		if relDir != "" {
+			depth += strings.Count(relDir, string(filepath.Separator)) + 1
+		}
+		if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+			continue
+		}
+		for _, e := range d.Entries {
+			meta := &NodeMetadata{
+				Name:    e.Name,
+				Path:    filepath.Join(dir, e.Name),
+				IsDir:   e.IsDir,
+				Size:    e.Size,
+				ModTime: time.Unix(0, e.ModTime),
+			}
+			rel := filepath.Join(relDir, e.Name)
+			if ok, known := q.matchIndexed(meta, e.Name, opts.Fuzzy, now); !known {
+				unsure = append(unsure, unsureHit{path: meta.Path, name: e.Name, rel: rel})
+				continue
+			} else if !ok {
+				continue
+			}
+			if score, matches, ok := q.Match(meta, e.Name, opts.Fuzzy, now); ok {
+				hits = append(hits, indexHit{rel: rel, score: score, matches: matches})
+			}
+		}
+	}
+	return hits, unsure, nil
+}
+
+// searchIndex answers a recursive search from the index and resolves the
+// best hits to Nodes below root.
+func (e *Engine) searchIndex(ctx context.Context, root *Node, q *Query, opts SearchOptions, now time.Time) ([]SearchResult, error) {
+	e.mu.Lock()
+	index := e.index
+	e.mu.Unlock()
+
+	hits, err := index.search(ctx, root.metadata.Path, q, opts, now)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, h := range hits {
+		results = append(results, SearchResult{RelPath: h.rel, Score: h.score, Matches: h.matches})
+	}
+	rankResults(results, opts)
+
+	resolved := results[:0]
+	for _, r := range results {
+		if opts.Limit > 0 && len(resolved) >= opts.Limit {
+			break
+		}
+		// entries deleted since the last update simply do not resolve
+		if n := nodeAt(root, r.RelPath); n != nil {
+			r.Node = n
+			resolved = append(resolved, r)
+		}
+	}
+	return resolved, nil
+}
+
+// nodeAt finds the node at rel below root, loading directories on the way.
+func nodeAt(root *Node, rel string) *Node {
+	n := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		var next *Node
+		for _, child := range n.Children() {
+			if filepath.Base(child.metadata.Path) == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
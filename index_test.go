@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndex_UpdateSaveAndReload(t *testing.T) {
+	root := makeTree(t, "a.txt", "sub/b.go", "sub/deep/c.go")
+	indexPath := filepath.Join(t.TempDir(), "cache", "index.gob.gz")
+
+	x := OpenIndex(indexPath, []string{root})
+	if !x.Stale() {
+		t.Fatal("a new index should be stale")
+	}
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	st := x.Status()
+	if st.Dirs != 3 || st.Entries != 5 {
+		t.Errorf("status = %d dirs, %d entries, want 3 and 5", st.Dirs, st.Entries)
+	}
+	if !x.Fresh(root) {
+		t.Error("index should be fresh right after an update")
+	}
+
+	reloaded := OpenIndex(indexPath, []string{root})
+	if got := reloaded.Status(); got.Entries != st.Entries || reloaded.Stale() {
+		t.Errorf("reloaded index has %d entries (stale %v), want %d", got.Entries, reloaded.Stale(), st.Entries)
+	}
+
+	// a different set of roots makes the stored index useless
+	if other := OpenIndex(indexPath, []string{t.TempDir()}); !other.Stale() {
+		t.Error("index for other roots should be stale")
+	}
+}
+
+func TestIndex_IncrementalUpdate(t *testing.T) {
+	root := makeTree(t, "a.txt", "sub/b.go", "other/c.go")
+	x := OpenIndex(filepath.Join(t.TempDir(), "index"), []string{root})
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	unchanged := x.dirs[filepath.Join(root, "other")]
+
+	if err := os.WriteFile(filepath.Join(root, "sub", "new.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(x.dirs[filepath.Join(root, "sub")].Entries); got != 2 {
+		t.Errorf("sub has %d entries after update, want 2", got)
+	}
+	if x.dirs[filepath.Join(root, "other")] != unchanged {
+		t.Error("unchanged directory was read again")
+	}
+
+	if err := x.Update(context.Background(), true, 2); err != nil {
+		t.Fatal(err)
+	}
+	if x.dirs[filepath.Join(root, "other")] == unchanged {
+		t.Error("full rebuild reused an old record")
+	}
+}
+
+func TestIndex_FreshSeesDeepChanges(t *testing.T) {
+	root := makeTree(t, "a.txt", "sub/deep/c.go")
+	x := OpenIndex(filepath.Join(t.TempDir(), "index"), []string{root})
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !x.Fresh(root) {
+		t.Fatal("index should be fresh right after an update")
+	}
+
+	// only sub/deep changes, root keeps its mtime
+	if err := os.WriteFile(filepath.Join(root, "sub", "deep", "new.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if x.Fresh(root) {
+		t.Error("index is fresh after a file was added two levels down")
+	}
+	if x.Fresh(filepath.Join(root, "sub", "deep")) {
+		t.Error("the changed directory itself is fresh")
+	}
+}
+
+func TestSearch_UsesFreshIndex(t *testing.T) {
+	root := makeTree(t, "one/target.txt", "two/three/target.md")
+	engine := NewEngine(root)
+	x := OpenIndex(filepath.Join(t.TempDir(), "index"), []string{root})
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	engine.SetIndex(x)
+
+	// drop a record so we can tell the index answered, not the disk
+	x.dirs[filepath.Join(root, "one")].Entries = nil
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	results, err := engine.Search(context.Background(), "target", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relPaths(results)
+	if len(got) != 1 || got[0] != "two/three/target.md" {
+		t.Errorf("got %v, want [two/three/target.md]", got)
+	}
+	if results[0].Node == nil || results[0].Node.metadata.Path != filepath.Join(root, "two", "three", "target.md") {
+		t.Error("index hit was not resolved to its node")
+	}
+}
+
+func TestSearch_IndexRechecksEditedFiles(t *testing.T) {
+	root := makeTree(t, "sub/grown.txt", "sub/shrunk.txt")
+	if err := os.WriteFile(filepath.Join(root, "sub", "shrunk.txt"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine(root)
+	x := OpenIndex(filepath.Join(t.TempDir(), "index"), []string{root})
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+	engine.SetIndex(x)
+
+	// editing in place leaves the mtime of sub alone, so its record is kept
+	if err := os.WriteFile(filepath.Join(root, "sub", "grown.txt"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "shrunk.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Update(context.Background(), false, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	for query, want := range map[string]string{
+		"type:file size:>1K":  "sub/grown.txt",
+		"txt NOT size:>1K":    "sub/shrunk.txt",
+		"grown OR size:>100K": "sub/grown.txt",
+	} {
+		results, err := engine.Search(context.Background(), query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := relPaths(results); len(got) != 1 || got[0] != want {
+			t.Errorf("%s: got %v, want [%s]", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// indexUpdatedMsg is sent when a background index update has finished
+type indexUpdatedMsg struct {
+	err error
+}
+
+// indexRedrawMsg only makes the index view redraw
+type indexRedrawMsg struct{}
+
+// updateIndexCmd runs an index update in the background.
+func updateIndexCmd(x *Index, full bool) tea.Cmd {
+	return func() tea.Msg {
+		return indexUpdatedMsg{err: x.Update(context.Background(), full, 4)}
+	}
+}
+
+func (m *model) updateIndexView(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			if view, ok := m.views.Pop(); ok {
+				m.currentView = view
+			}
+		case "u":
+			if m.index != nil && !m.index.Status().Building {
+				return tea.Batch(updateIndexCmd(m.index, false), m.markIndexBuilding())
+			}
+		case "r":
+			if m.index != nil && !m.index.Status().Building {
+				return tea.Batch(updateIndexCmd(m.index, true), m.markIndexBuilding())
+			}
+		}
+	}
+	return nil
+}
+
+// markIndexBuilding redraws once the update has had a moment to start, so
+// the view shows it as running.
+func (m *model) markIndexBuilding() tea.Cmd {
+	return tea.Tick(50*time.Millisecond, func(time.Time) tea.Msg { return indexRedrawMsg{} })
+}
+
+func (m model) renderIndexView() string {
+	var s strings.Builder
+	s.WriteString(headerStyle.Render("Filename Index") + "\n")
+
+	if m.index == nil {
+		s.WriteString(warningStyle.Render("No index: the cache directory is not available.") + "\n")
+		return docStyle.Render(s.String())
+	}
+
+	st := m.index.Status()
+	row := func(label, value string) {
+		s.WriteString(fmt.Sprintf("%s %s\n", titleMutedStyle.Render(fmt.Sprintf("%-10s", label)), value))
+	}
+	row("File", titlePathStyle.Render(st.Path))
+	row("Roots", titlePathStyle.Render(strings.Join(st.Roots, ", ")))
+	row("Folders", fmt.Sprint(st.Dirs))
+	row("Entries", fmt.Sprint(st.Entries))
+
+	updated := "never"
+	if !st.Updated.IsZero() {
+		updated = st.Updated.Format("Jan 02 15:04:05")
+	}
+	row("Updated", updated)
+
+	state := successStyle.Render("fresh")
+	switch {
+	case st.Building:
+		state = accentStyle.Render("updating…")
+	case st.Err != nil:
+		state = highPriorityStyle.Render(st.Err.Error())
+	case m.index.Stale():
+		state = warningStyle.Render("stale, searches walk the disk")
+	}
+	row("State", state)
+
+	s.WriteString("\n")
+	s.WriteString(titleAccentStyle.Render("u") + titleMutedStyle.Render(" update  "))
+	s.WriteString(titleAccentStyle.Render("r") + titleMutedStyle.Render(" full rebuild  "))
+	s.WriteString(titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back"))
+	return docStyle.Render(s.String())
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Resolve finds the node at path, a relative path starting at the current
+// directory. Directories on the way are loaded, entries they are missing
+// are looked up on disk, and archives on the way are opened. A path above
+// the root makes the tree grow upwards.
+func (e *Engine) Resolve(path string) (*Node, error) {
+	e.mu.Lock()
+	current, root := e.current, e.root
+	e.mu.Unlock()
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(current.metadata.Path, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(root.metadata.Path, path)
+	for err == nil && (rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		// above the root, grow the tree upwards
+		if root, err = e.Parent(root); err != nil {
+			return nil, err
+		}
+		rel, err = filepath.Rel(root.metadata.Path, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is outside %s", path, root.metadata.Path)
+	}
+
+	n := root
+	if rel == "." {
+		return n, nil
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if !n.metadata.IsDir {
+			if !isArchive(n.metadata.Path) {
+				return nil, &fs.PathError{Op: "resolve", Path: n.metadata.Path, Err: errors.New("not a directory")}
+			}
+			if n, err = e.OpenArchive(n); err != nil {
+				return nil, err
+			}
+		}
+		n.Children()
+		if err := n.Err(); err != nil {
+			return nil, err
+		}
+		child := nodeAt(n, part)
+		// an entry made after the directory was read
+		if child == nil && patchChild(n, part) {
+			child = nodeAt(n, part)
+		}
+		if child == nil {
+			return nil, &fs.PathError{Op: "resolve", Path: filepath.Join(n.metadata.Path, part), Err: fs.ErrNotExist}
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// completePath completes the last element of input, a path typed into the
+// go to prompt, against the entries of its directory on fsys. It returns
+// input extended as far as all matches agree, and the matches. Directories
+// end in a separator, dotfiles only match a prefix starting with a dot.
+func completePath(fsys FS, cwd, input string) (string, []string) {
+	sep := string(filepath.Separator)
+	dirPart, prefix := "", input
+	if i := strings.LastIndex(input, sep); i >= 0 {
+		dirPart, prefix = input[:i+1], input[i+1:]
+	}
+	// a bare ~ or $VAR that names a directory just gets its separator
+	if dirPart == "" && (strings.HasPrefix(prefix, "~") || strings.HasPrefix(prefix, "$")) {
+		if info, err := fsys.Stat(expandPath(prefix)); err == nil && info.IsDir() {
+			return input + sep, nil
+		}
+	}
+
+	dir := cwd
+	if dirPart != "" {
+		dir = expandPath(dirPart)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(cwd, dir)
+		}
+	}
+	entries, err := readDir(fsys, dir)
+	if err != nil {
+		return input, nil
+	}
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if info, err := fsys.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			name += sep
+		}
+		matches = append(matches, name)
+	}
+	if len(matches) == 0 {
+		return input, nil
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			// names may share the first bytes of different runes
+			_, size := utf8.DecodeLastRuneInString(common)
+			common = common[:len(common)-size]
+		}
+	}
+	return dirPart + common, matches
+}
+
+// jumpedMsg is sent when the path typed into the go to prompt has been
+// resolved
+type jumpedMsg struct {
+	node *Node
+	err  error
+}
+
+// maxCompletions is how many matches the go to prompt lists
+const maxCompletions = 8
+
+func (m *model) startJump() tea.Cmd {
+	m.file.jumping = true
+	m.file.frecent = false
+	m.file.completions = nil
+	m.file.jump.Placeholder = "path, tab completes"
+	m.file.jump.SetValue("")
+	return m.file.jump.Focus()
+}
+
+// frecencyPrunedMsg is sent when directories that are gone have been
+// dropped from the visited ones
+type frecencyPrunedMsg struct{}
+
+// startFrecentJump opens the prompt on the visited directories, listing
+// the best ones before anything is typed. Directories that are gone are
+// pruned in the background meanwhile.
+func (m *model) startFrecentJump() tea.Cmd {
+	cmd := m.startJump()
+	m.file.frecent = true
+	m.file.jump.Placeholder = "a few letters of a visited directory"
+	m.updateFrecent()
+	engine := m.engine
+	return tea.Batch(cmd, func() tea.Msg {
+		engine.PruneFrecent()
+		return frecencyPrunedMsg{}
+	})
+}
+
+// updateFrecent lists the visited directories matching the prompt, the
+// one enter jumps to first.
+func (m *model) updateFrecent() {
+	m.file.completions = nil
+	for _, match := range m.engine.Frecent(m.file.jump.Value(), maxCompletions) {
+		m.file.completions = append(m.file.completions, match.Path)
+	}
+}
+
+func (m *model) updateJumpPrompt(msg tea.Msg) (fileModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.file.jumping = false
+			m.file.jump.Blur()
+			return m.file, nil
+		case "tab":
+			if m.file.frecent {
+				return m.file, nil
+			}
+			completed, matches := completePath(m.engine.current.FS(), m.engine.current.metadata.Path, m.file.jump.Value())
+			m.file.jump.SetValue(completed)
+			m.file.jump.CursorEnd()
+			m.file.completions = nil
+			if len(matches) > 1 {
+				m.file.completions = matches
+			}
+			return m.file, nil
+		case "enter":
+			m.file.jumping = false
+			m.file.jump.Blur()
+			target, engine := expandPath(m.file.jump.Value()), m.engine
+			if m.file.frecent {
+				if len(m.file.completions) == 0 {
+					m.file.notice = "no visited directory matches " + m.file.jump.Value()
+					return m.file, nil
+				}
+				target = m.file.completions[0]
+			}
+			return m.file, func() tea.Msg {
+				n, err := engine.Resolve(target)
+				return jumpedMsg{node: n, err: err}
+			}
+		}
+	}
+	var cmd tea.Cmd
+	m.file.jump, cmd = m.file.jump.Update(msg)
+	if _, ok := msg.(tea.KeyMsg); ok && m.file.frecent {
+		m.updateFrecent()
+	}
+	return m.file, cmd
+}
+
+// jumpTo opens a directory the go to prompt resolved, or the directory of
+// a file with the file selected.
+func (m *model) jumpTo(n *Node) tea.Cmd {
+	parent := n.Parent()
+	if n.metadata.IsDir || parent == nil {
+		return m.openDir(n)
+	}
+	cmd := m.openDir(parent)
+	m.selectNode(n)
+	return cmd
+}
+
+// selectNode moves the file list cursor to n, if it is shown.
+func (m *model) selectNode(n *Node) {
+	for i, it := range m.file.list.Items() {
+		if it.(item).node == n {
+			m.file.list.Select(i)
+			break
+		}
+	}
+}
+
+func (m model) renderJumpPrompt() string {
+	s := "Go to: " + m.file.jump.View()
+	if m.file.frecent {
+		s = "Jump: " + m.file.jump.View()
+	}
+	if len(m.file.completions) > 0 {
+		shown := m.file.completions
+		if len(shown) > maxCompletions {
+			shown = append(shown[:maxCompletions:maxCompletions], "…")
+		}
+		s += "\n" + titleMutedStyle.Render(strings.Join(shown, "  "))
+	}
+	return s
+}
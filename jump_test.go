@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Resolve(t *testing.T) {
+	fsys, root := makeMemTree(t, "a/b/c/file.txt", "a/other", "x.txt")
+	writeZip(t, fsys, filepath.Join(root, "a", "pack.zip"), map[string]string{"in/deep.txt": "z"})
+	engine := newMemEngine(t, fsys, root)
+
+	n, err := engine.Resolve(filepath.Join(root, "a", "b", "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.metadata.Path != filepath.Join(root, "a", "b", "c") || n.parent.parent != nodeAt(engine.current, "a") {
+		t.Errorf("resolved %s into the wrong place", n.metadata.Path)
+	}
+	if again, _ := engine.Resolve(filepath.Join(root, "a", "b", "c")); again != n {
+		t.Error("resolving twice should give the same node")
+	}
+
+	engine.ChangeDirectory(n)
+	if rel, err := engine.Resolve(filepath.Join("..", "..", "other")); err != nil || rel != nodeAt(engine.root, filepath.Join("a", "other")) {
+		t.Errorf("relative path resolved to %v, %v", rel, err)
+	}
+
+	// made after a was read
+	fsys.WriteFile(filepath.Join(root, "a", "new.txt"), nil, 0644)
+	if _, err := engine.Resolve(filepath.Join(root, "a", "new.txt")); err != nil {
+		t.Errorf("new file: %v", err)
+	}
+
+	if deep, err := engine.Resolve(filepath.Join(root, "a", "pack.zip", "in", "deep.txt")); err != nil || !inArchive(deep) {
+		t.Errorf("inside the zip: %v, %v", deep, err)
+	}
+
+	if _, err := engine.Resolve(filepath.Join(root, "a", "missing", "x")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing path: %v", err)
+	}
+	if _, err := engine.Resolve(filepath.Join(root, "x.txt", "y")); err == nil {
+		t.Error("a path through a file should fail")
+	}
+}
+
+func TestCompletePath(t *testing.T) {
+	fsys, root := makeMemTree(t, "projects/app/main.go", "projects/api/x", "pictures/a", ".profile", "notes.txt", "menu/café.txt", "menu/cafè.md")
+	t.Setenv("PROJ", filepath.Join(root, "projects"))
+	sep := string(filepath.Separator)
+
+	for _, tc := range []struct {
+		input, want string
+		matches     int
+	}{
+		{"pro", "projects" + sep, 1},
+		{"p", "p", 2},
+		{"projects" + sep + "a", "projects" + sep + "ap", 2},
+		{"projects" + sep + "app" + sep + "m", "projects" + sep + "app" + sep + "main.go", 1},
+		{".p", ".profile", 1},
+		{"zzz", "zzz", 0},
+		{"$PROJ", "$PROJ" + sep, 0},
+		{"$PROJ" + sep + "api", "$PROJ" + sep + "api" + sep, 1},
+		{root + sep + "no", root + sep + "notes.txt", 1},
+		// é and è start with the same byte, the prompt must stay valid UTF-8
+		{"menu" + sep + "c", "menu" + sep + "caf", 2},
+	} {
+		got, matches := completePath(fsys, root, tc.input)
+		if got != tc.want || len(matches) != tc.matches {
+			t.Errorf("%q: got %q with %v, want %q with %d matches", tc.input, got, matches, tc.want, tc.matches)
+		}
+	}
+
+	// dotfiles stay out unless asked for
+	if _, matches := completePath(fsys, root, ""); strings.Contains(strings.Join(matches, " "), ".profile") {
+		t.Errorf("matches for nothing = %v", matches)
+	}
+}
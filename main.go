@@ -1,18 +1,125 @@
 package main;
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-func main() {
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
 
-	m:= NewModel()
-	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		log.Fatal(err)
+// options are what the command line asks for
+type options struct {
+	// start is the directory or webdav:// share to open, empty for the
+	// title screen at dir
+	start      string
+	workers    int
+	showHidden bool
+	configPath string
+	version    bool
+}
+
+// parseArgs reads the command line, without the program name.
+func parseArgs(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	flags := flag.NewFlagSet(appName, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s [flags] [path | webdav://host/path]\n", appName)
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&opts.workers, "workers", 4, "number of workers compressing zip archives")
+	flags.BoolVar(&opts.showHidden, "show-hidden", false, "show dotfiles from the start")
+	flags.StringVar(&opts.configPath, "config", "", "config file to read instead of the default one")
+	flags.BoolVar(&opts.version, "version", false, "print the version and exit")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		opts.start = flags.Arg(0)
+	default:
+		flags.Usage()
+		return nil, errors.New("only one start path can be given")
+	}
+	if opts.workers <= 0 {
+		return nil, fmt.Errorf("--workers must be at least 1, not %d", opts.workers)
+	}
+	return opts, nil
+}
+
+// startPath checks the start path from the command line and makes it
+// absolute. Remote locations are checked when they are opened.
+func startPath(start string) (string, error) {
+	if isRemote(start) {
+		return start, nil
+	}
+	path, err := filepath.Abs(expandPath(start))
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
 	}
+	return path, nil
+}
 
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			// the usage was asked for, it is not an error
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", appName, err)
+		os.Exit(2)
+	}
+}
 
+func run(args []string) error {
+	opts, err := parseArgs(args, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if opts.version {
+		fmt.Println(appName, version)
+		return nil
+	}
 
-}
\ No newline at end of file
+	cfgPath := opts.configPath
+	if cfgPath == "" {
+		if cfgPath, err = DefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", cfgPath, err)
+	}
+	if opts.showHidden {
+		cfg.ShowHidden = true
+	}
+
+	if opts.start != "" {
+		if opts.start, err = startPath(opts.start); err != nil {
+			return err
+		}
+	}
+	m, err := NewModel(cfg, opts)
+	if err != nil {
+		return err
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	_, err = p.Run()
+	m.engine.Close()
+	return err
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"--workers", "8", "--show-hidden", "-config=/tmp/c.json", "some/dir"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.workers != 8 || !opts.showHidden || opts.configPath != "/tmp/c.json" || opts.start != "some/dir" {
+		t.Errorf("got %+v", opts)
+	}
+
+	opts, err = parseArgs(nil, io.Discard)
+	if err != nil || opts.start != "" || opts.workers != 4 || opts.version {
+		t.Errorf("defaults = %+v, %v", opts, err)
+	}
+	if opts, _ := parseArgs([]string{"--version"}, io.Discard); !opts.version {
+		t.Error("--version not set")
+	}
+
+	for _, args := range [][]string{{"a", "b"}, {"--workers", "0"}, {"--nope"}} {
+		if _, err := parseArgs(args, io.Discard); err == nil {
+			t.Errorf("%v should fail", args)
+		}
+	}
+	if _, err := parseArgs([]string{"-h"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("-h gave %v", err)
+	}
+}
+
+func TestStartPath(t *testing.T) {
+	root := makeTree(t, "file.txt")
+	t.Chdir(root)
+
+	if got, err := startPath("."); err != nil || got != root {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := startPath("file.txt"); err == nil {
+		t.Error("a file is not a start directory")
+	}
+	if _, err := startPath(filepath.Join(root, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing directory: %v", err)
+	}
+	if got, _ := startPath("webdav://host/x"); got != "webdav://host/x" {
+		t.Errorf("remote location changed to %q", got)
+	}
+}
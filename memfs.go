@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemFS is an FS kept in memory. It has directories, files and symlinks,
+// which is enough to browse, search and test the tree without a disk.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string // for symlinks
+	modTime time.Time
+	// children holds the names in a directory
+	children map[string]bool
+}
+
+// maxMemLinkHops bounds symlink chains, like ELOOP on a real disk
+const maxMemLinkHops = 40
+
+var errMemLoop = errors.New("too many levels of symbolic links")
+
+func NewMemFS() *MemFS {
+	root := &memFile{mode: fs.ModeDir | 0755, modTime: time.Now(), children: map[string]bool{}}
+	return &MemFS{files: map[string]*memFile{string(filepath.Separator): root}}
+}
+
+func memErr(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// parentDir returns the directory name is created in. The caller holds m.mu.
+func (m *MemFS) parentDir(op, name string) (*memFile, error) {
+	parent, err := m.resolve(filepath.Dir(name), true, 0)
+	if err != nil {
+		return nil, memErr(op, name, err)
+	}
+	if !parent.mode.IsDir() {
+		return nil, memErr(op, name, errors.New("not a directory"))
+	}
+	return parent, nil
+}
+
+// resolve finds the file at name, following symlinks in its directories
+// and, if follow is set, in name itself. The caller holds m.mu.
+func (m *MemFS) resolve(name string, follow bool, hops int) (*memFile, error) {
+	name = filepath.Clean(name)
+	if f, ok := m.files[name]; ok && (!follow || f.mode&fs.ModeSymlink == 0) {
+		return f, nil
+	}
+	real, err := m.realPath(name, follow, hops)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := m.files[real]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+// realPath resolves the symlinks on the way to name. The caller holds m.mu.
+func (m *MemFS) realPath(name string, follow bool, hops int) (string, error) {
+	sep := string(filepath.Separator)
+	if name == sep {
+		return sep, nil
+	}
+	dir, err := m.realPath(filepath.Dir(name), true, hops)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	f, ok := m.files[path]
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	if f.mode&fs.ModeSymlink == 0 || !follow {
+		return path, nil
+	}
+	if hops >= maxMemLinkHops {
+		return "", errMemLoop
+	}
+	target := f.target
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return m.realPath(filepath.Clean(target), true, hops+1)
+}
+
+func (m *MemFS) stat(op, name string, follow bool) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.resolve(name, follow, 0)
+	if err != nil {
+		return nil, memErr(op, name, err)
+	}
+	return memInfo{name: filepath.Base(name), f: f, size: int64(len(f.data))}, nil
+}
+
+func (m *MemFS) Lstat(name string) (fs.FileInfo, error) { return m.stat("lstat", name, false) }
+func (m *MemFS) Stat(name string) (fs.FileInfo, error)  { return m.stat("stat", name, true) }
+
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.resolve(name, false, 0)
+	if err != nil {
+		return "", memErr("readlink", name, err)
+	}
+	if f.mode&fs.ModeSymlink == 0 {
+		return "", memErr("readlink", name, errors.New("invalid argument"))
+	}
+	return f.target, nil
+}
+
+func (m *MemFS) EvalSymlinks(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	real, err := m.realPath(filepath.Clean(name), true, 0)
+	if err != nil {
+		return "", memErr("evalsymlinks", name, err)
+	}
+	return real, nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.resolve(name, true, 0)
+	if err != nil {
+		return nil, memErr("open", name, err)
+	}
+	info := memInfo{name: filepath.Base(name), f: f, size: int64(len(f.data))}
+	if !f.mode.IsDir() {
+		return &memReader{Reader: bytes.NewReader(f.data), info: info}, nil
+	}
+
+	real, _ := m.realPath(filepath.Clean(name), true, 0)
+	names := make([]string, 0, len(f.children))
+	for child := range f.children {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		cf := m.files[filepath.Join(real, child)]
+		entries[i] = fs.FileInfoToDirEntry(memInfo{name: child, f: cf, size: int64(len(cf.data))})
+	}
+	return &memDir{info: info, entries: entries}, nil
+}
+
+// Create makes or truncates name. The contents appear when the writer is
+// closed.
+func (m *MemFS) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.parentDir("open", name); err != nil {
+		return nil, err
+	}
+	if f, err := m.resolve(name, true, 0); err == nil && f.mode.IsDir() {
+		return nil, memErr("open", name, errors.New("is a directory"))
+	}
+	return &memWriter{m: m, name: name}, nil
+}
+
+// WriteFile creates name with data, like os.WriteFile.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.put("open", name, &memFile{mode: perm &^ fs.ModeType, data: append([]byte(nil), data...), modTime: time.Now()})
+}
+
+// put stores f as name, replacing what was there unless it is a
+// directory. The caller holds m.mu.
+func (m *MemFS) put(op, name string, f *memFile) error {
+	parent, err := m.parentDir(op, name)
+	if err != nil {
+		return err
+	}
+	dir, _ := m.realPath(filepath.Dir(filepath.Clean(name)), true, 0)
+	path := filepath.Join(dir, filepath.Base(name))
+	if old, ok := m.files[path]; ok && old.mode.IsDir() {
+		return memErr(op, name, errors.New("is a directory"))
+	}
+	m.files[path] = f
+	parent.children[filepath.Base(path)] = true
+	parent.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.resolve(name, false, 0); err == nil {
+		return memErr("mkdir", name, fs.ErrExist)
+	}
+	return m.put("mkdir", name, &memFile{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: map[string]bool{}})
+}
+
+// MkdirAll creates name and any missing parents, like os.MkdirAll.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	name = filepath.Clean(name)
+	if info, err := m.Stat(name); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return memErr("mkdir", name, errors.New("not a directory"))
+	}
+	if parent := filepath.Dir(name); parent != name {
+		if err := m.MkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := m.Mkdir(name, perm); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// Symlink creates name pointing at target, like os.Symlink.
+func (m *MemFS) Symlink(target, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.resolve(name, false, 0); err == nil {
+		return memErr("symlink", name, fs.ErrExist)
+	}
+	return m.put("symlink", name, &memFile{mode: fs.ModeSymlink | 0777, target: target, modTime: time.Now()})
+}
+
+// Chtimes sets the modification time of name.
+func (m *MemFS) Chtimes(name string, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.resolve(name, true, 0)
+	if err != nil {
+		return memErr("chtimes", name, err)
+	}
+	f.modTime = mtime
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, err := m.realPath(filepath.Dir(filepath.Clean(name)), true, 0)
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	if _, ok := m.files[path]; !ok {
+		return nil
+	}
+	if path == string(filepath.Separator) {
+		return memErr("removeall", name, errors.New("cannot remove the root"))
+	}
+	m.removeLocked(path)
+	parent := m.files[dir]
+	delete(parent.children, filepath.Base(path))
+	parent.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) removeLocked(path string) {
+	f := m.files[path]
+	for child := range f.children {
+		m.removeLocked(filepath.Join(path, child))
+	}
+	delete(m.files, path)
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldDir, err := m.realPath(filepath.Dir(filepath.Clean(oldname)), true, 0)
+	if err != nil {
+		return memErr("rename", oldname, err)
+	}
+	oldPath := filepath.Join(oldDir, filepath.Base(oldname))
+	f, ok := m.files[oldPath]
+	if !ok {
+		return memErr("rename", oldname, fs.ErrNotExist)
+	}
+	newParent, err := m.parentDir("rename", newname)
+	if err != nil {
+		return err
+	}
+	newDir, _ := m.realPath(filepath.Dir(filepath.Clean(newname)), true, 0)
+	newPath := filepath.Join(newDir, filepath.Base(newname))
+	if old, ok := m.files[newPath]; ok && old.mode.IsDir() && len(old.children) > 0 {
+		return memErr("rename", newname, errors.New("directory not empty"))
+	}
+
+	// move the subtree below a directory along with it
+	moved := map[string]*memFile{}
+	prefix := oldPath + string(filepath.Separator)
+	for path, sub := range m.files {
+		if len(path) > len(prefix) && path[:len(prefix)] == prefix {
+			moved[filepath.Join(newPath, path[len(prefix):])] = sub
+			delete(m.files, path)
+		}
+	}
+	delete(m.files, oldPath)
+	delete(m.files[oldDir].children, filepath.Base(oldPath))
+	for path, sub := range moved {
+		m.files[path] = sub
+	}
+	m.files[newPath] = f
+	newParent.children[filepath.Base(newPath)] = true
+	return nil
+}
+
+// memInfo describes a memFile for Stat and ReadDir.
+type memInfo struct {
+	name string
+	f    *memFile
+	size int64
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.f.mode }
+func (i memInfo) ModTime() time.Time { return i.f.modTime }
+func (i memInfo) IsDir() bool        { return i.f.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
+
+type memReader struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memDir lists a snapshot of the directory taken when it was opened.
+type memDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, memErr("read", d.info.name, errors.New("is a directory"))
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+type memWriter struct {
+	bytes.Buffer
+	m    *MemFS
+	name string
+}
+
+func (w *memWriter) Close() error {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	return w.m.put("write", w.name, &memFile{mode: 0644, data: w.Bytes(), modTime: time.Now()})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// makeMemTree creates the given files (and their parent directories) in a
+// fresh in-memory filesystem and returns it with the path of the tree.
+func makeMemTree(t *testing.T, files ...string) (*MemFS, string) {
+	t.Helper()
+	fsys := NewMemFS()
+	root := filepath.Join(string(filepath.Separator), "tree")
+	if err := fsys.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fsys, root
+}
+
+// newMemEngine opens an engine on fsys at root.
+func newMemEngine(t *testing.T, fsys FS, root string) *Engine {
+	t.Helper()
+	engine, err := NewEngineFS(fsys, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestMemFS_ReadWrite(t *testing.T) {
+	fsys, root := makeMemTree(t, "a/b.txt")
+
+	w, err := fsys.Create(filepath.Join(root, "a", "new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello")
+	w.Close()
+
+	entries, err := readDir(fsys, filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "b.txt" || entries[1].Name() != "new.txt" {
+		t.Fatalf("got %v", entries)
+	}
+	f, err := fsys.Open(filepath.Join(root, "a", "new.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "hello" {
+		t.Errorf("read %q", data)
+	}
+
+	if err := fsys.Rename(filepath.Join(root, "a"), filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(root, "c", "b.txt")); err != nil {
+		t.Errorf("renamed subtree lost its files: %v", err)
+	}
+	if err := fsys.RemoveAll(filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(filepath.Join(root, "c", "b.txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stat after RemoveAll: %v", err)
+	}
+	if _, err := fsys.Open(filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("open of a missing file: %v", err)
+	}
+}
+
+func TestMemFS_Symlinks(t *testing.T) {
+	fsys, root := makeMemTree(t, "real/file.txt")
+	fsys.Symlink("real", filepath.Join(root, "link"))
+	fsys.Symlink("loop", filepath.Join(root, "loop"))
+
+	info, err := fsys.Stat(filepath.Join(root, "link", "file.txt"))
+	if err != nil || info.IsDir() {
+		t.Fatalf("stat through a link: %v %v", info, err)
+	}
+	if info, _ := fsys.Lstat(filepath.Join(root, "link")); info.Mode()&fs.ModeSymlink == 0 {
+		t.Error("Lstat followed the link")
+	}
+	if real, err := evalSymlinks(fsys, filepath.Join(root, "link")); err != nil || real != filepath.Join(root, "real") {
+		t.Errorf("resolved to %q, %v", real, err)
+	}
+	if _, err := fsys.Stat(filepath.Join(root, "loop")); err == nil {
+		t.Error("a symlink loop resolved")
+	}
+}
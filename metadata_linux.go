@@ -0,0 +1,167 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fillStatMetadata copies the inode level fields out of info. It reuses the
+// stat done while reading the directory, so listing stays one call per entry.
+func fillStatMetadata(m *NodeMetadata, info os.FileInfo) {
+	m.Mode = info.Mode()
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	m.Uid = st.Uid
+	m.Gid = st.Gid
+	m.Inode = st.Ino
+	m.Nlink = uint64(st.Nlink)
+	m.Dev = uint64(st.Dev)
+	m.AccessTime = time.Unix(st.Atim.Unix())
+	m.ChangeTime = time.Unix(st.Ctim.Unix())
+}
+
+// hardLinkKey identifies the inode behind info. shared is false for files
+// with a single link, which need no deduplication.
+func hardLinkKey(info os.FileInfo) (key fileKey, shared bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return key, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, true
+}
+
+// fileDevice is the device info lives on, 0 when unknown.
+func fileDevice(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev)
+	}
+	return 0
+}
+
+// diskUsage is the space info takes on disk, in bytes.
+func diskUsage(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return info.Size()
+}
+
+// LoadProperties stats path again and works out everything the Properties
+// view shows, including owner names and the filesystem it lives on.
+func LoadProperties(path string) (*Properties, error) {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := &NodeMetadata{Name: path, Path: path, Size: st.Size, ModTime: info.ModTime()}
+	fillStatMetadata(meta, info)
+	if meta.Mode&os.ModeSymlink != 0 {
+		meta.IsSymlink = true
+		meta.LinkTarget, _ = os.Readlink(path)
+	}
+
+	p := &Properties{NodeMetadata: *meta}
+	p.Owner = lookupUser(st.Uid)
+	p.Group = lookupGroup(st.Gid)
+	p.DevString = fmt.Sprintf("%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+
+	p.FSType, p.MountPoint = findMount(path, uint64(st.Dev))
+	if p.FSType == "" {
+		var fs unix.Statfs_t
+		if err := unix.Statfs(path, &fs); err == nil {
+			p.FSType = fmt.Sprintf("%#x", fs.Type)
+		}
+	}
+	return p, nil
+}
+
+// findMount looks path up in /proc/self/mountinfo. The mount with the same
+// device wins; bind mounts of one device fall back to the longest matching
+// mount point.
+func findMount(path string, dev uint64) (fsType, mountPoint string) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	real, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		real = filepath.Dir(path)
+	}
+	real = filepath.Join(real, filepath.Base(path))
+
+	want := fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev))
+	best := -1
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+1 >= len(fields) {
+			continue
+		}
+		point := unescapeMountPath(fields[4])
+		if !underPath(real, point) {
+			continue
+		}
+		score := len(point)
+		if fields[2] == want {
+			score += 1 << 20
+		}
+		if score > best {
+			best = score
+			fsType, mountPoint = fields[sep+1], point
+		}
+	}
+	return fsType, mountPoint
+}
+
+// unescapeMountPath undoes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func underPath(path, dir string) bool {
+	if dir == "/" || path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
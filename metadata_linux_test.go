@@ -0,0 +1,70 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeMetadata_StatFields(t *testing.T) {
+	root := makeTree(t, "a.txt")
+	path := filepath.Join(root, "a.txt")
+	if err := os.Link(path, filepath.Join(root, "b.txt")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+
+	meta, err := NewNodeMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Inode == 0 || meta.Nlink != 2 {
+		t.Errorf("inode %d, nlink %d, want a real inode and 2 links", meta.Inode, meta.Nlink)
+	}
+	if meta.Uid != uint32(os.Getuid()) || meta.Mode.Perm() == 0 {
+		t.Errorf("uid %d, mode %v", meta.Uid, meta.Mode)
+	}
+	if meta.ChangeTime.IsZero() || meta.AccessTime.IsZero() {
+		t.Error("expected access and change times")
+	}
+}
+
+func TestLoadProperties(t *testing.T) {
+	root := makeTree(t, "a.txt")
+	path := filepath.Join(root, "a.txt")
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadProperties(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if octalMode(p.Mode) != 0o640 {
+		t.Errorf("mode = %04o, want 0640", octalMode(p.Mode))
+	}
+	if p.Owner == "" || p.Group == "" || p.DevString == "" {
+		t.Errorf("owner %q, group %q, dev %q", p.Owner, p.Group, p.DevString)
+	}
+	if p.FSType == "" || p.MountPoint == "" {
+		t.Errorf("fs type %q, mount point %q", p.FSType, p.MountPoint)
+	}
+
+	if _, err := LoadProperties(filepath.Join(root, "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"/mnt/plain":         "/mnt/plain",
+		`/mnt/my\040disk`:    "/mnt/my disk",
+		`/mnt/back\134slash`: `/mnt/back\slash`,
+		`/mnt/short\04`:      `/mnt/short\04`,
+	} {
+		if got := unescapeMountPath(in); got != want {
+			t.Errorf("unescapeMountPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
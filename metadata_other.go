@@ -0,0 +1,31 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// fillStatMetadata only has the mode to offer off Linux.
+func fillStatMetadata(m *NodeMetadata, info os.FileInfo) {
+	m.Mode = info.Mode()
+}
+
+func hardLinkKey(info os.FileInfo) (key fileKey, shared bool) {
+	return key, false
+}
+
+func fileDevice(info os.FileInfo) uint64 {
+	return 0
+}
+
+func diskUsage(info os.FileInfo) int64 {
+	return info.Size()
+}
+
+// LoadProperties gives the portable subset of the properties elsewhere.
+func LoadProperties(path string) (*Properties, error) {
+	meta, err := NewNodeMetadata(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Properties{NodeMetadata: *meta}, nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	// "path/filepath"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
 	// // "strings"
 	// "time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -21,6 +27,11 @@ const (
 	actionView
 	settingsView
 	zipActionView
+	indexView
+	propsView
+	usageView
+	dupesView
+	bookmarksView
 )
 
 
@@ -31,6 +42,9 @@ type item struct {
 }
 
 func (i item) Title() string { 
+	if (i.node.Err() != nil || i.node.metadata.BrokenLink) && !i.node.metadata.IsDir {
+		return "✗ " + i.node.metadata.Name
+	}
 	if i.node.metadata.IsDir {
 		return "▸ " + i.node.metadata.Name
 	}
@@ -38,16 +52,144 @@ func (i item) Title() string {
 }
 
 func (i item) Description() string {
+	if err := i.node.Err(); err != nil {
+		return "⚠ " + describeErr(err)
+	}
 	size := formatSize(i.node.metadata.Size)
 	if i.node.metadata.IsDir {
 		size = "Directory"
+		if u, ok := i.node.Usage(); ok {
+			size = fmt.Sprintf("%s • %d files", formatSize(u.Size), u.Files)
+		}
 	}
 	modTime := i.node.metadata.ModTime.Format("Jan 02 15:04")
+	if owner := i.node.metadata.ArchiveOwner; owner != "" {
+		size = fmt.Sprintf("%s • %s %s", size, i.node.metadata.Mode, owner)
+	}
+	if i.node.metadata.BrokenLink {
+		return fmt.Sprintf("→ %s • broken link", i.node.metadata.LinkTarget)
+	}
+	if i.node.metadata.IsSymlink {
+		return fmt.Sprintf("→ %s • %s • %s", i.node.metadata.LinkTarget, size, modTime)
+	}
+	if packed := i.node.metadata.PackedSize; packed > 0 && !i.node.metadata.IsDir {
+		return fmt.Sprintf("%s • packed %s • %s", size, formatSize(packed), modTime)
+	}
 	return fmt.Sprintf("%s • %s", size, modTime)
 }
 
 func (i item) FilterValue() string { return i.node.metadata.Name }
 
+// describeErr turns a filesystem error into a short reason for the list.
+func describeErr(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	case errors.Is(err, fs.ErrNotExist):
+		return "deleted while reading"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// searchItem is a search hit, titled by its path relative to the search root
+type searchItem struct {
+	item
+	rel string
+	// matches are rune positions in Title() that matched the query
+	matches []int
+
+	// content search hits show the matching line instead of size and date
+	line        int
+	snippet     string
+	descMatches []int
+}
+
+func (i searchItem) Title() string {
+	if i.line > 0 {
+		return fmt.Sprintf("  %s:%d", i.rel, i.line)
+	}
+	if i.node.metadata.IsDir {
+		return "▸ " + i.rel
+	}
+	return "  " + i.rel
+}
+
+func (i searchItem) Description() string {
+	if i.line > 0 {
+		return i.snippet
+	}
+	return i.item.Description()
+}
+
+func (i searchItem) FilterValue() string { return i.rel }
+
+// searchResultsMsg carries the results of a search started by startSearch
+type searchResultsMsg struct {
+	seq     int
+	results []SearchResult
+	err     error
+}
+
+// dirChangedMsg is sent when the watcher patched the children of dir
+type dirChangedMsg struct {
+	dir *Node
+}
+
+// waitForChange waits for the next directory the watcher changed. It does
+// nothing when watching is off.
+func waitForChange(changes <-chan *Node) tea.Cmd {
+	if changes == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		return dirChangedMsg{dir: <-changes}
+	}
+}
+
+// grepStream connects a running content search to the UI. err is set
+// before hits is closed.
+type grepStream struct {
+	hits chan GrepHit
+	err  error
+}
+
+// grepHitsMsg carries the hits a content search found since the last one
+type grepHitsMsg struct {
+	seq    int
+	hits   []GrepHit
+	stream *grepStream
+}
+
+// grepDoneMsg is sent when a content search has finished
+type grepDoneMsg struct {
+	seq int
+	err error
+}
+
+// sizeStream connects a running directory size calculation to the UI.
+// view is the view that started it, the file list unless set.
+type sizeStream struct {
+	measured chan *Node
+	view     View
+}
+
+// dirSizesMsg carries the directories measured since the last one
+type dirSizesMsg struct {
+	seq    int
+	nodes  []*Node
+	stream *sizeStream
+}
+
+// dirSizesDoneMsg is sent when every directory in the list is measured
+type dirSizesDoneMsg struct {
+	seq  int
+	view View
+}
+
 // actionItem for the action menu
 type actionItem struct {
 	title, desc string
@@ -79,11 +221,70 @@ func (i settingItem) FilterValue() string { return i.feature.Name }
 
 type fileModel struct {
 	list list.Model
+	// debug shows the node cache counters under the list
+	debug bool
+
+	// loading is the path of the directory being read in the background,
+	// if any
+	loading    string
+	loadSeq    int
+	loadCancel context.CancelFunc
+	spinner    spinner.Model
+
+	// notice says why the last enter did not open anything
+	notice string
+
+	// upload asks for a local path to copy into a remote directory
+	upload    textinput.Model
+	uploading bool
+
+	// jump is the go to prompt, completions the matches of the last tab.
+	// With frecent set it matches visited directories instead of paths.
+	jump        textinput.Model
+	jumping     bool
+	frecent     bool
+	completions []string
+
+	// pendingMark is set by m and ', the next key names the mark
+	pendingMark markPending
+
+	// sizeCancel stops the directory size calculation, nil when none runs
+	sizeSeq    int
+	sizeCancel context.CancelFunc
+}
+
+// dirLoadedMsg is sent when a background directory read started by openDir
+// has finished
+type dirLoadedMsg struct {
+	seq int
+	dir *Node
+	err error
+}
+
+// parentReadMsg is sent when the directory above from, which was not in
+// the tree yet, has been read for the view that went up
+type parentReadMsg struct {
+	view   View
+	seq    int
+	from   *Node
+	parent *Node
+	err    error
 }
 
 type searchModel struct {
 	input textinput.Model
 	list  list.Model
+
+	opts      SearchOptions
+	content   bool // search file contents instead of names
+	query     string
+	seq       int
+	searching bool
+	cancel    context.CancelFunc
+	err       error
+	// parseErr is the error for the query currently in the input, shown
+	// right below it while typing
+	parseErr error
 }
 
 type actionModel struct {
@@ -103,25 +304,71 @@ type model struct {
 	currentView View
 	engine      *Engine
 	compressingEngine *CompressEngine
+	index       *Index
 	views Stack[View]
 	file    fileModel
 	search  searchModel
 	actions actionModel
 	settings settingsModel
 	zip     zipModel
+	props   propsModel
+	usage   usageModel
+	dupes   dupesModel
+	marks   bookmarksModel
+
+	bookmarks *Bookmarks
 
 	width, height int
+	// startup is run by Init, for work NewModel has set up
+	startup tea.Cmd
 }
 
-func NewModel() model {
+func NewModel(cfg *Config, opts *options) (model, error) {
 	// Initialize Engine
-	
-	engine := NewEngine(dir);
+	start := opts.start
+	if start == "" {
+		start = dir
+	}
+	engine, err := OpenEngine(start, cfg)
+	if err != nil {
+		return model{}, err
+	}
+	engine.SetCacheBudget(cfg.CacheNodes)
+	engine.SetFollowSymlinks(*cfg.FollowSymlinks)
+	if path, err := DefaultSortPrefsPath(); err == nil {
+		engine.SetSortPrefs(OpenSortPrefs(path))
+	}
+	engine.SetExclude(cfg.Exclude)
+	engine.SetFilter(FilterOptions{
+		HideDotfiles: !cfg.ShowHidden,
+		HideIgnored:  !cfg.ShowIgnored,
+		HideExcluded: len(cfg.Exclude) > 0,
+	})
+
+	// Filename index, answers recursive searches while it is fresh
+	var index *Index
+	if path, err := DefaultIndexPath(); err == nil {
+		index = OpenIndex(path, cfg.IndexRoots)
+		engine.SetIndex(index)
+	}
+
+	// Visited directories, for jumping back to them by a few letters
+	if path, err := DefaultFrecencyPath(); err == nil {
+		engine.SetFrecency(OpenFrecency(path))
+	}
+
+	// Without watching the lists just go stale, so this is not fatal
+	engine.EnableWatching()
 
 	// File List
-	fileList := list.New(nodesToItems(engine.current.children), list.NewDefaultDelegate(), 0, 0)
-	fileList.Title = "File Explorer"
+	children, _ := engine.List()
+	fileList := list.New(nodesToItems(children), newFileDelegate(), 0, 0)
+	fileList.Title = "File Explorer · " + engine.SortMode().String()
 	fileList.SetShowHelp(false)
+	uploadInput := textinput.New()
+	uploadInput.Placeholder = "local file or directory to upload"
+	jumpInput := textinput.New()
+	jumpInput.Placeholder = "path, tab completes"
 
 	// Search
 	ti := textinput.New()
@@ -129,7 +376,7 @@ func NewModel() model {
 	ti.CharLimit = 156
 	ti.Width = 20
 
-	searchList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	searchList := list.New([]list.Item{}, newSearchDelegate(), 0, 0)
 	searchList.Title = "Search Results"
 	searchList.SetShowHelp(false)
 
@@ -145,14 +392,32 @@ func NewModel() model {
 	actionList.Title = "Actions"
 	actionList.SetShowHelp(false)
 
+	// Disk usage, the view draws its own header
+	usageList := list.New([]list.Item{}, usageDelegate{}, 0, 0)
+	usageList.SetShowTitle(false)
+	usageList.SetShowStatusBar(false)
+	usageList.SetShowHelp(false)
+
+	// Duplicates
+	dupesList := list.New([]list.Item{}, dupeDelegate{}, 0, 0)
+	dupesList.SetShowTitle(false)
+	dupesList.SetShowStatusBar(false)
+	dupesList.SetShowHelp(false)
+
+	// Bookmarks, kept next to the config so they can be edited by hand
+	bookmarksList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	bookmarksList.Title = "Bookmarks"
+	bookmarksList.SetShowHelp(false)
+	bookmarksPath, _ := DefaultBookmarksPath()
+
 	// Settings
 	// Initialize features list
 	features := []Feature{
 		{Name: "Open Files", Description: "Open files with default Windows app", Status: "todo", Priority: "high"},
 		{Name: "Copy/Paste", Description: "Ctrl+C, Ctrl+V file operations", Status: "todo", Priority: "high"},
-		{Name: "Fuzzy Search", Description: "Fast fuzzy file matching", Status: "todo", Priority: "high"},
+		{Name: "Fuzzy Search", Description: "Fast fuzzy file matching", Status: "done", Priority: "high"},
 		{Name: "Multi-Select", Description: "Space to select, bulk operations", Status: "todo", Priority: "high"},
-		{Name: "Sort Options", Description: "Sort by name/size/date/type", Status: "todo", Priority: "medium"},
+		{Name: "Sort Options", Description: "Sort by name/size/date/type", Status: "done", Priority: "medium"},
 	}
 	
 	settingsItems := make([]list.Item, len(features))
@@ -166,20 +431,39 @@ func NewModel() model {
 	zipInput := textinput.New()
 	zipInput.Placeholder = "archive.zip"
 
-	return model{
+	m := model{
 		currentView: titleView,
 		engine:      engine,
-		compressingEngine: NewCompressEngine(4),
-		file:        fileModel{list: fileList},
-		search:      searchModel{input: ti, list: searchList},
+		compressingEngine: NewCompressEngine(opts.workers),
+		index:       index,
+		file:        fileModel{list: fileList, upload: uploadInput, jump: jumpInput, spinner: spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(accentStyle))},
+		search:      searchModel{input: ti, list: searchList, opts: DefaultSearchOptions()},
 		actions:     actionModel{list: actionList},
 		settings:    settingsModel{list: settingsList},
 		zip:         zipModel{input: zipInput},
+		usage:       usageModel{list: usageList},
+		marks:       bookmarksModel{list: bookmarksList},
+		bookmarks:   OpenBookmarks(bookmarksPath),
+		dupes:       dupesModel{list: dupesList, marked: map[*Node]bool{}},
+	}
+	// a start path given on the command line skips the title screen
+	if opts.start != "" {
+		m.views.Push(titleView)
+		m.currentView = fileView
+		m.startup = m.measureSizes()
 	}
+	return m, nil
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	cmds := []tea.Cmd{textinput.Blink, waitForChange(m.engine.Changes())}
+	if m.index != nil && m.index.Stale() {
+		cmds = append(cmds, updateIndexCmd(m.index, false))
+	}
+	if m.startup != nil {
+		cmds = append(cmds, m.startup)
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -197,6 +481,159 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.search.list.SetSize(msg.Width-h, msg.Height-v-4) // -4 for input height roughly
 		m.actions.list.SetSize(msg.Width-h, msg.Height-v)
 		m.settings.list.SetSize(msg.Width-h, msg.Height-v)
+		m.usage.list.SetSize(msg.Width-h, msg.Height-v-4) // header, summary and footer
+		m.dupes.list.SetSize(msg.Width-h, msg.Height-v-4)
+		m.marks.list.SetSize(msg.Width-h, msg.Height-v-1)
+	case searchResultsMsg:
+		// results of a search that was cancelled or replaced are dropped
+		if msg.seq != m.search.seq {
+			return m, nil
+		}
+		m.search.searching = false
+		m.search.cancel = nil
+		m.search.err = msg.err
+		return m, m.search.list.SetItems(resultsToItems(msg.results))
+	case grepHitsMsg:
+		if msg.seq != m.search.seq {
+			return m, nil
+		}
+		items := m.search.list.Items()
+		for _, hit := range msg.hits {
+			items = append(items, hitToItem(hit))
+		}
+		return m, tea.Batch(m.search.list.SetItems(items), waitForGrepHits(msg.seq, msg.stream))
+	case grepDoneMsg:
+		if msg.seq != m.search.seq {
+			return m, nil
+		}
+		m.search.searching = false
+		m.search.cancel = nil
+		m.search.err = msg.err
+		return m, nil
+	case frecencyPrunedMsg:
+		if m.file.jumping && m.file.frecent {
+			m.updateFrecent()
+		}
+		return m, nil
+	case jumpedMsg:
+		if msg.err != nil {
+			m.file.notice = msg.err.Error()
+			return m, nil
+		}
+		return m, m.jumpTo(msg.node)
+	case transferMsg:
+		if msg.err != nil {
+			m.file.notice = msg.verb + " failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.file.notice = msg.verb + " " + msg.path
+		if msg.dir == m.engine.current {
+			return m, m.refreshFileList()
+		}
+		return m, nil
+	case extractedMsg:
+		if msg.err != nil {
+			m.file.notice = "extract failed: " + msg.err.Error()
+		} else {
+			m.file.notice = "extracted to " + msg.path
+		}
+		return m, nil
+	case editorFinishedMsg:
+		m.search.err = msg.err
+		return m, nil
+	case dirLoadedMsg:
+		// a read the user navigated away from
+		if msg.seq != m.file.loadSeq {
+			return m, nil
+		}
+		m.file.loading = ""
+		m.file.loadCancel = nil
+		m.updateFileTitle()
+		if msg.err != nil {
+			m.file.notice = msg.err.Error()
+			return m, nil
+		}
+		m.engine.ChangeDirectory(msg.dir)
+		return m, m.showCurrentDir()
+	case parentReadMsg:
+		if msg.view == usageView {
+			return m, m.usageParentRead(msg)
+		}
+		if msg.seq != m.file.loadSeq {
+			return m, nil
+		}
+		m.file.loading = ""
+		m.updateFileTitle()
+		if msg.err != nil {
+			m.file.notice = msg.err.Error()
+			return m, nil
+		}
+		cmd := m.openDir(msg.parent)
+		m.selectNode(msg.from)
+		return m, cmd
+	case spinner.TickMsg:
+		if m.file.loading == "" {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.file.spinner, cmd = m.file.spinner.Update(msg)
+		m.updateFileTitle()
+		return m, cmd
+	case dirSizesMsg:
+		if msg.stream.view == usageView {
+			return m, m.usageSizes(msg)
+		}
+		if msg.seq != m.file.sizeSeq {
+			return m, nil
+		}
+		// the list reads totals straight from the nodes, only the order
+		// can be out of date
+		var cmd tea.Cmd
+		if m.engine.SortMode().Key == SortSize {
+			cmd = m.refreshFileList()
+		}
+		return m, tea.Batch(cmd, waitForSizes(msg.seq, msg.stream))
+	case dupesFoundMsg, dupesActionMsg:
+		// a scan can finish after the user left the view
+		cmd := m.updateDupesView(msg)
+		if _, ok := msg.(dupesActionMsg); ok {
+			cmd = tea.Batch(cmd, m.refreshFileList())
+		}
+		return m, cmd
+	case usageDeletedMsg:
+		cmd := m.updateUsageView(msg)
+		if msg.node.Parent() == m.engine.current {
+			cmd = tea.Batch(cmd, m.refreshFileList())
+		}
+		return m, cmd
+	case dirSizesDoneMsg:
+		if msg.view == usageView {
+			if msg.seq == m.usage.seq {
+				m.usage.cancel = nil
+			}
+			return m, nil
+		}
+		if msg.seq != m.file.sizeSeq {
+			return m, nil
+		}
+		m.file.sizeCancel = nil
+		m.updateFileTitle()
+		return m, nil
+	case dirChangedMsg:
+		invalidateUsage(msg.dir)
+		m.engine.DirChanged(msg.dir)
+		var cmds []tea.Cmd
+		if msg.dir == m.engine.current {
+			cmds = append(cmds, m.refreshFileList())
+		}
+		if m.showsChangeOf(msg.dir) {
+			cmds = append(cmds, m.measureSizes())
+		}
+		cmds = append(cmds, waitForChange(m.engine.Changes()))
+		return m, tea.Batch(cmds...)
+	case indexUpdatedMsg, indexRedrawMsg:
+		// the index view reads the result straight from the index
+		return m, nil
 	}
 
 	switch m.currentView {
@@ -209,7 +646,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "enter":
 				m.views.Push(m.currentView)
 				m.currentView = fileView
-				return m, nil
+				return m, m.measureSizes()
 			case "s":
 				m.views.Push(m.currentView)
 				m.currentView = searchView
@@ -219,6 +656,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.views.Push(m.currentView)
 				m.currentView = settingsView
 				return m, nil
+			case "i":
+				m.views.Push(m.currentView)
+				m.currentView = indexView
+				return m, nil
 			}
 		}
 	case fileView:
@@ -289,6 +730,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		newInput, newCmd := m.zip.input.Update(msg)
 		m.zip.input = newInput
 		cmds = append(cmds, newCmd)
+
+	case indexView:
+		cmds = append(cmds, m.updateIndexView(msg))
+	case propsView:
+		cmds = append(cmds, m.updatePropsView(msg))
+	case usageView:
+		cmds = append(cmds, m.updateUsageView(msg))
+	case dupesView:
+		cmds = append(cmds, m.updateDupesView(msg))
+	case bookmarksView:
+		cmds = append(cmds, m.updateBookmarksView(msg))
 	}
 
 	return m, tea.Batch(cmds...)
@@ -296,6 +748,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *model) updateFileView(msg tea.Msg) (fileModel, tea.Cmd) {
 	var cmd tea.Cmd
+	if m.file.uploading {
+		return m.updateUploadPrompt(msg)
+	}
+	if m.file.jumping {
+		return m.updateJumpPrompt(msg)
+	}
+	if key, ok := msg.(tea.KeyMsg); ok && m.file.pendingMark != noMark {
+		return m.file, m.handleMark(key.String())
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
@@ -314,29 +775,92 @@ func (m *model) updateFileView(msg tea.Msg) (fileModel, tea.Cmd) {
 			m.views.Push(m.currentView)
 			m.currentView = settingsView
 			return m.file, nil
+		case "i":
+			m.views.Push(m.currentView)
+			m.currentView = indexView
+			return m.file, nil
+		case "D":
+			m.file.debug = !m.file.debug
+			return m.file, nil
+		case "U":
+			return m.file, m.openUsage(m.engine.current)
+		case "F":
+			return m.file, m.openDupes(m.engine.current)
+		case "o":
+			return m.file, m.changeSort(func(s *SortMode) { s.Key = s.Key.Next() })
+		case "O":
+			return m.file, m.changeSort(func(s *SortMode) { s.Reverse = !s.Reverse })
+		case "t":
+			return m.file, m.changeSort(func(s *SortMode) { s.DirsFirst = !s.DirsFirst })
+		case ".":
+			return m.file, m.changeFilter(func(f *FilterOptions) { f.HideDotfiles = !f.HideDotfiles })
+		case "I":
+			return m.file, m.changeFilter(func(f *FilterOptions) { f.HideIgnored = !f.HideIgnored })
+		case "X":
+			return m.file, m.changeFilter(func(f *FilterOptions) { f.HideExcluded = !f.HideExcluded })
+		case "e":
+			if selected := m.file.list.SelectedItem(); selected != nil {
+				cmd = m.extract(selected.(item).node)
+			}
+			return m.file, cmd
+		case ":":
+			return m.file, m.startJump()
+		case "z":
+			return m.file, m.startFrecentJump()
+		case "m":
+			m.file.pendingMark = setMark
+			m.file.notice = "mark this directory as: press a key, esc cancels"
+			return m.file, nil
+		case "'":
+			m.file.pendingMark = jumpMark
+			m.file.notice = "jump to mark: press its key, B lists them"
+			return m.file, nil
+		case "B":
+			return m.file, m.openBookmarks()
+		case "ctrl+d":
+			if selected := m.file.list.SelectedItem(); selected != nil {
+				cmd = m.download(selected.(item).node)
+			}
+			return m.file, cmd
+		case "ctrl+u":
+			if _, ok := m.engine.current.FS().(*davFS); !ok {
+				m.file.notice = "uploads go to a remote directory"
+				return m.file, nil
+			}
+			m.file.uploading = true
+			m.file.upload.SetValue("")
+			return m.file, m.file.upload.Focus()
 		case "enter":
 			// Navigate into directory
 			selected := m.file.list.SelectedItem()
 			if selected != nil {
 				itm := selected.(item)
 				if itm.node.metadata.IsDir {
-					loadChildren(itm.node)
-					m.engine.ChangeDirectory(itm.node)
-					// Update list items
-					cmd = m.file.list.SetItems(nodesToItems(m.engine.current.children))
-					m.file.list.ResetSelected()
+					cmd = m.openDir(itm.node)
+				} else if isArchive(itm.node.metadata.Path) {
+					cmd = m.openArchive(itm.node)
 				}
 			}
 			return m.file, cmd
 		case "backspace", "left":
-			// Go up
-			if m.engine.current.parent != nil {
-				m.engine.ChangeDirectory(m.engine.current.parent)
-				cmd = m.file.list.SetItems(nodesToItems(m.engine.current.children))
-				m.file.list.ResetSelected()
+			// going back while a directory loads just stays here
+			if m.file.loading != "" {
+				m.cancelLoad()
+				return m.file, nil
 			}
-			return m.file, cmd
+			// Go up, above where we started too
+			from := m.engine.current
+			if parent := from.Parent(); parent != nil {
+				cmd = m.openDir(parent)
+				m.selectNode(from)
+				return m.file, cmd
+			}
+			m.file.notice = ""
+			m.file.loading = filepath.Dir(from.metadata.Path)
+			m.updateFileTitle()
+			return m.file, tea.Batch(m.file.spinner.Tick, m.readParent(fileView, m.file.loadSeq, from))
 		case "esc":
+			m.cancelLoad()
 			view,poss := m.views.Pop();
 			if(poss==true){
 				m.currentView=view;
@@ -356,34 +880,51 @@ func (m *model) updateSearchView(msg tea.Msg) (searchModel, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "esc":
+			m.stopSearch()
 			view,poss := m.views.Pop();
 			if(poss==true){
 				m.currentView=view;
 				m.search.input.Blur()
 			}
 			return m.search, nil
+		case "ctrl+r":
+			m.search.opts.Recursive = !m.search.opts.Recursive
+			m.stopSearch()
+			return m.search, nil
+		case "ctrl+f":
+			m.search.opts.Fuzzy = !m.search.opts.Fuzzy
+			m.stopSearch()
+			return m.search, nil
+		case "ctrl+g":
+			m.search.content = !m.search.content
+			m.stopSearch()
+			m.validateQuery()
+			return m.search, nil
 		case "enter":
 			if m.search.input.Focused() {
+				if m.search.parseErr != nil {
+					return m.search, nil
+				}
 				// Perform search
-				query := m.search.input.Value()
-				results, _ := m.engine.Search(query)
-				m.search.list.SetItems(nodesToItems(results))
+				cmd = m.startSearch(m.search.input.Value())
 				m.search.input.Blur()
+				return m.search, cmd
 			} else {
 				// Navigate to result
 				selected := m.search.list.SelectedItem()
 				if selected != nil {
-					itm := selected.(item)
+					itm := selected.(searchItem)
+					if itm.line > 0 && isLocal(itm.node.FS()) {
+						return m.search, openInEditor(itm.node.metadata.Path, itm.line)
+					}
 					if itm.node.metadata.IsDir {
-						loadChildren(itm.node)
-						m.engine.ChangeDirectory(itm.node)
-						m.file.list.SetItems(nodesToItems(m.engine.current.children))
+						cmd = m.openDir(itm.node)
 						m.views.Push(m.currentView)
 						m.currentView = fileView
 					}
 				}
 			}
-			return m.search, nil
+			return m.search, cmd
 		case "tab":
 			if m.search.input.Focused() {
 				m.search.input.Blur()
@@ -396,12 +937,370 @@ func (m *model) updateSearchView(msg tea.Msg) (searchModel, tea.Cmd) {
 
 	if m.search.input.Focused() {
 		m.search.input, cmd = m.search.input.Update(msg)
+		m.validateQuery()
+		// a running search is for a query the user no longer wants
+		if m.search.searching && m.search.input.Value() != m.search.query {
+			m.stopSearch()
+		}
 	} else {
 		m.search.list, cmd = m.search.list.Update(msg)
 	}
 	return m.search, cmd
 }
 
+// openDir makes node the current directory. A directory that still has to
+// be read from disk is loaded in the background, with a spinner in the list
+// title, and only entered once the read is done.
+func (m *model) openDir(node *Node) tea.Cmd {
+	m.cancelLoad()
+	if err := m.engine.CanEnter(node); err != nil {
+		m.file.notice = err.Error()
+		return nil
+	}
+	m.file.notice = ""
+	if node.Loaded() {
+		m.engine.ChangeDirectory(node)
+		return m.showCurrentDir()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.file.loading = node.metadata.Path
+	m.file.loadCancel = cancel
+	m.updateFileTitle()
+
+	seq := m.file.loadSeq
+	engine := m.engine
+	return tea.Batch(m.file.spinner.Tick, func() tea.Msg {
+		return dirLoadedMsg{seq: seq, dir: node, err: engine.Load(ctx, node)}
+	})
+}
+
+// readParent reads the directory above from in the background. Above the
+// start directory it is not in the tree yet and has to come from disk.
+func (m *model) readParent(view View, seq int, from *Node) tea.Cmd {
+	engine := m.engine
+	return func() tea.Msg {
+		parent, err := engine.Parent(from)
+		return parentReadMsg{view: view, seq: seq, from: from, parent: parent, err: err}
+	}
+}
+
+// openArchive enters the archive file node like a directory.
+func (m *model) openArchive(node *Node) tea.Cmd {
+	root, err := m.engine.OpenArchive(node)
+	if err != nil {
+		m.file.notice = err.Error()
+		return nil
+	}
+	return m.openDir(root)
+}
+
+// extractedMsg is sent when an entry has been copied out of an archive
+type extractedMsg struct {
+	path string
+	err  error
+}
+
+// extract copies node out of the archive it is in, next to the archive.
+func (m *model) extract(node *Node) tea.Cmd {
+	if !inArchive(node) {
+		m.file.notice = "only entries inside an archive can be extracted"
+		return nil
+	}
+	engine := m.engine
+	return func() tea.Msg {
+		path, err := engine.Extract(node)
+		return extractedMsg{path: path, err: err}
+	}
+}
+
+// transferMsg is sent when a download or upload has finished. dir is the
+// directory that changed, if it is in the tree.
+type transferMsg struct {
+	verb string
+	path string
+	dir  *Node
+	err  error
+}
+
+// download copies node from a remote share to the download directory.
+func (m *model) download(node *Node) tea.Cmd {
+	if isLocal(node.FS()) {
+		m.file.notice = "only remote entries can be downloaded"
+		return nil
+	}
+	engine := m.engine
+	return func() tea.Msg {
+		path, err := engine.Download(node, defaultDownloadDir())
+		return transferMsg{verb: "downloaded", path: path, err: err}
+	}
+}
+
+func (m *model) updateUploadPrompt(msg tea.Msg) (fileModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.file.uploading = false
+			m.file.upload.Blur()
+			return m.file, nil
+		case "enter":
+			m.file.uploading = false
+			m.file.upload.Blur()
+			src := expandPath(m.file.upload.Value())
+			dir, engine := m.engine.current, m.engine
+			return m.file, func() tea.Msg {
+				n, err := engine.Upload(src, dir)
+				msg := transferMsg{verb: "uploaded", dir: dir, err: err}
+				if n != nil {
+					msg.path = n.metadata.Path
+				}
+				return msg
+			}
+		}
+	}
+	var cmd tea.Cmd
+	m.file.upload, cmd = m.file.upload.Update(msg)
+	return m.file, cmd
+}
+
+// cancelLoad gives up on the directory being loaded, if any.
+func (m *model) cancelLoad() {
+	if m.file.loadCancel != nil {
+		m.file.loadCancel()
+		m.file.loadCancel = nil
+	}
+	m.file.loadSeq++
+	m.file.loading = ""
+	m.updateFileTitle()
+}
+
+// showCurrentDir fills the file list with the current directory, cursor
+// on top, and starts measuring its directories.
+func (m *model) showCurrentDir() tea.Cmd {
+	children, _ := m.engine.List()
+	cmd := m.file.list.SetItems(nodesToItems(children))
+	m.file.list.ResetSelected()
+	return tea.Batch(cmd, m.measureSizes())
+}
+
+// measureSizes measures the directories in the file list that have no
+// total yet in the background, replacing a measurement still running.
+// Totals arrive as dirSizesMsgs. Directories off the local disk are left
+// to the disk usage view, walking a share or archive on every visit costs
+// too much.
+func (m *model) measureSizes() tea.Cmd {
+	m.stopSizes()
+	defer m.updateFileTitle()
+
+	var dirs []*Node
+	for _, it := range m.file.list.Items() {
+		n := it.(item).node
+		if !n.metadata.IsDir || n.metadata.IsSymlink || isMountPoint(n) || !isLocal(n.FS()) {
+			continue
+		}
+		if _, ok := n.Usage(); !ok {
+			dirs = append(dirs, n)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.file.sizeCancel = cancel
+	seq := m.file.sizeSeq
+	engine := m.engine
+	workers := m.search.opts.Workers
+	stream := &sizeStream{measured: make(chan *Node, 16)}
+	go func() {
+		engine.MeasureDirs(ctx, dirs, workers, stream.measured)
+		close(stream.measured)
+	}()
+	return waitForSizes(seq, stream)
+}
+
+// stopSizes cancels the running size calculation, if any.
+func (m *model) stopSizes() {
+	if m.file.sizeCancel != nil {
+		m.file.sizeCancel()
+		m.file.sizeCancel = nil
+	}
+	m.file.sizeSeq++
+}
+
+// waitForSizes waits for the next measured directories, handing over all
+// that are already done.
+func waitForSizes(seq int, stream *sizeStream) tea.Cmd {
+	return func() tea.Msg {
+		n, ok := <-stream.measured
+		if !ok {
+			return dirSizesDoneMsg{seq: seq, view: stream.view}
+		}
+		nodes := []*Node{n}
+		for {
+			select {
+			case n, ok := <-stream.measured:
+				if !ok {
+					return dirSizesMsg{seq: seq, nodes: nodes, stream: stream}
+				}
+				nodes = append(nodes, n)
+			default:
+				return dirSizesMsg{seq: seq, nodes: nodes, stream: stream}
+			}
+		}
+	}
+}
+
+// showsChangeOf reports whether a change in dir affects a total shown in
+// the file list: dir is the current directory or below one of its entries.
+func (m *model) showsChangeOf(dir *Node) bool {
+	for n := dir; n != nil; n = n.Parent() {
+		if n == m.engine.current {
+			return true
+		}
+	}
+	return false
+}
+
+// changeSort applies change to the sort mode of the current directory and
+// relists it.
+func (m *model) changeSort(change func(*SortMode)) tea.Cmd {
+	mode := m.engine.SortMode()
+	change(&mode)
+	if err := m.engine.SetSortMode(mode); err != nil {
+		m.file.notice = "could not save sort mode: " + err.Error()
+	}
+	return m.refreshFileList()
+}
+
+// changeFilter toggles what the file list hides and relists it.
+func (m *model) changeFilter(change func(*FilterOptions)) tea.Cmd {
+	opts := m.engine.Filter()
+	change(&opts)
+	m.engine.SetFilter(opts)
+	return tea.Batch(m.refreshFileList(), m.measureSizes())
+}
+
+func (m *model) updateFileTitle() {
+	title := "File Explorer · " + m.engine.SortMode().String()
+	if d, ok := m.engine.current.FS().(*davFS); ok {
+		title += " · " + d.String()
+	}
+	if m.file.loading != "" {
+		title += " " + m.file.spinner.View() + " loading " + filepath.Base(m.file.loading) + "…"
+	} else if m.file.sizeCancel != nil {
+		title += " · measuring…"
+	}
+	m.file.list.Title = title
+}
+
+// refreshFileList reloads the file list from the current directory, keeping
+// the cursor on the same entry if it still exists.
+func (m *model) refreshFileList() tea.Cmd {
+	var selectedPath string
+	if selected := m.file.list.SelectedItem(); selected != nil {
+		selectedPath = selected.(item).node.metadata.Path
+	}
+	children, _ := m.engine.List()
+	cmd := m.file.list.SetItems(nodesToItems(children))
+	m.updateFileTitle()
+	for i, child := range children {
+		if child.metadata.Path == selectedPath {
+			m.file.list.Select(i)
+			break
+		}
+	}
+	return cmd
+}
+
+// validateQuery checks the text in the search input, so problems can be
+// shown while the user is still typing.
+func (m *model) validateQuery() {
+	if m.search.content {
+		m.search.parseErr = nil
+		if m.search.input.Value() != "" {
+			_, m.search.parseErr = compileGrepPattern(m.search.input.Value())
+		}
+		return
+	}
+	_, m.search.parseErr = ParseQuery(m.search.input.Value())
+}
+
+// startSearch cancels any running search and starts a new one for query in
+// the background. Name search results come back as a searchResultsMsg,
+// content search hits are streamed as grepHitsMsgs.
+func (m *model) startSearch(query string) tea.Cmd {
+	m.stopSearch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.search.cancel = cancel
+	m.search.query = query
+	m.search.searching = true
+	m.search.err = nil
+
+	seq := m.search.seq
+	engine := m.engine
+	opts := m.search.opts
+
+	if m.search.content {
+		m.search.list.SetItems(nil)
+		stream := &grepStream{hits: make(chan GrepHit, 64)}
+		go func() {
+			err := engine.Grep(ctx, query, opts, stream.hits)
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+			stream.err = err
+			close(stream.hits)
+		}()
+		return waitForGrepHits(seq, stream)
+	}
+
+	return func() tea.Msg {
+		results, err := engine.Search(ctx, query, opts)
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		return searchResultsMsg{seq: seq, results: results, err: err}
+	}
+}
+
+// waitForGrepHits waits for the next hits of a content search. It hands
+// over everything that is already queued so a fast search does not cost a
+// redraw per line.
+func waitForGrepHits(seq int, stream *grepStream) tea.Cmd {
+	return func() tea.Msg {
+		hit, ok := <-stream.hits
+		if !ok {
+			return grepDoneMsg{seq: seq, err: stream.err}
+		}
+		hits := []GrepHit{hit}
+		for len(hits) < cap(stream.hits) {
+			select {
+			case hit, ok := <-stream.hits:
+				if !ok {
+					return grepHitsMsg{seq: seq, hits: hits, stream: stream}
+				}
+				hits = append(hits, hit)
+			default:
+				return grepHitsMsg{seq: seq, hits: hits, stream: stream}
+			}
+		}
+		return grepHitsMsg{seq: seq, hits: hits, stream: stream}
+	}
+}
+
+// stopSearch cancels the running search, if any, and makes sure its
+// results are ignored when they arrive.
+func (m *model) stopSearch() {
+	if m.search.cancel != nil {
+		m.search.cancel()
+		m.search.cancel = nil
+	}
+	m.search.seq++
+	m.search.searching = false
+}
+
 func (m *model) handleAction(act actionItem) (tea.Model, tea.Cmd) {
 	selected := m.file.list.SelectedItem()
 	if selected == nil {
@@ -418,6 +1317,9 @@ func (m *model) handleAction(act actionItem) (tea.Model, tea.Cmd) {
 		m.currentView = zipActionView
 		m.zip.input.Focus()
 		return m, textinput.Blink
+	case "props":
+		m.showProperties(fileItem.node)
+		return m, nil
 	case "delete":
 		// Implement delete logic interaction or command
 	}
@@ -432,12 +1334,33 @@ func (m model) View() string {
 	case titleView:
 		return m.renderTitleView()
 	case fileView:
-		return docStyle.Render(m.file.list.View())
+		parts := []string{m.file.list.View()}
+		if err := m.engine.current.Err(); err != nil {
+			parts = append([]string{highPriorityStyle.Render(fmt.Sprintf(
+				"✗ cannot read %s: %s", m.engine.current.metadata.Path, describeErr(err),
+			))}, parts...)
+		}
+		parts = append(parts, m.renderFilterStatus())
+		if m.file.notice != "" {
+			parts = append(parts, warningStyle.Render("⚠ "+m.file.notice))
+		}
+		if m.file.uploading {
+			parts = append(parts, "Upload: "+m.file.upload.View())
+		}
+		if m.file.jumping {
+			parts = append(parts, m.renderJumpPrompt())
+		}
+		if m.file.debug {
+			parts = append(parts, m.renderCacheStats())
+		}
+		return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, parts...))
 	case searchView:
 		return docStyle.Render(
 			lipgloss.JoinVertical(lipgloss.Left, 
 				m.search.input.View(),
+				m.renderQueryError(),
 				"We are currently in " + m.engine.root.metadata.Path,
+				m.renderSearchStatus(),
 				m.search.list.View(),
 			),
 		)
@@ -451,11 +1374,104 @@ func (m model) View() string {
 			m.zip.chosenPath,
 			m.zip.input.View(),
 		))
+	case indexView:
+		return m.renderIndexView()
+	case propsView:
+		return m.renderPropsView()
+	case usageView:
+		return m.renderUsageView()
+	case dupesView:
+		return m.renderDupesView()
+	case bookmarksView:
+		return m.renderBookmarksView()
 	}
 	return "Unknown View"
 }
 
 
+func (m model) renderCacheStats() string {
+	st := m.engine.CacheStats()
+	return statusStyle.Render(fmt.Sprintf(
+		"cache: %d/%d nodes in %d dirs • %d hits • %d misses • %d evicted",
+		st.Nodes, st.Budget, st.Dirs, st.Hits, st.Misses, st.Evictions,
+	))
+}
+
+// renderQueryError shows why the query in the search input does not parse,
+// or the filter syntax when it does.
+func (m model) renderQueryError() string {
+	if m.search.parseErr != nil {
+		return highPriorityStyle.Render("✗ " + m.search.parseErr.Error())
+	}
+	if m.search.content {
+		return titleMutedStyle.Render("text is matched literally, /regex/ for a regular expression")
+	}
+	return titleMutedStyle.Render("filters: ext:go size:>10M modified:<7d type:dir name:/re/  AND OR NOT ( )")
+}
+
+func (m model) renderSearchStatus() string {
+	mode := "current folder"
+	if m.search.opts.Recursive {
+		mode = fmt.Sprintf("recursive (depth %d, limit %d)", m.search.opts.MaxDepth, m.search.opts.Limit)
+	}
+	if m.search.content {
+		mode += ", file contents"
+	} else if m.search.opts.Fuzzy {
+		mode += ", fuzzy"
+	}
+	s := titleMutedStyle.Render("mode: ") + titlePathStyle.Render(mode) +
+		titleMutedStyle.Render("  ctrl+r recursive  ctrl+f fuzzy  ctrl+g contents")
+	if m.search.searching {
+		s += titleAccentStyle.Render("  searching…")
+	}
+	if m.search.err != nil {
+		s += "  " + warningStyle.Render(m.search.err.Error())
+	}
+	return s
+}
+
+func resultsToItems(results []SearchResult) []list.Item {
+	items := make([]list.Item, len(results))
+	for i, r := range results {
+		// Matches index the base name, the title is "▸ " + relative path
+		offset := 2 + utf8.RuneCountInString(r.RelPath) - utf8.RuneCountInString(filepath.Base(r.RelPath))
+		matches := make([]int, len(r.Matches))
+		for j, pos := range r.Matches {
+			matches[j] = offset + pos
+		}
+		items[i] = searchItem{item: item{node: r.Node}, rel: r.RelPath, matches: matches}
+	}
+	return items
+}
+
+func hitToItem(hit GrepHit) list.Item {
+	return searchItem{
+		item:        item{node: hit.Node},
+		rel:         hit.RelPath,
+		line:        hit.Line,
+		snippet:     hit.Snippet,
+		descMatches: hit.Matches,
+	}
+}
+
+// renderFilterStatus shows the state of the three filters and how many
+// entries each of them hides here.
+func (m model) renderFilterStatus() string {
+	opts, hidden := m.engine.Filter(), m.engine.Hidden()
+	toggle := func(key, label string, on bool, count int) string {
+		state := titleMutedStyle.Render(label + " shown")
+		if on {
+			state = accentStyle.Render(fmt.Sprintf("%s hidden (%d)", label, count))
+		}
+		return titleAccentStyle.Render(key) + " " + state
+	}
+	return statusStyle.Render(strings.Join([]string{
+		toggle(".", "dotfiles", opts.HideDotfiles, hidden.Dotfiles),
+		toggle("I", "ignored", opts.HideIgnored, hidden.Ignored),
+		toggle("X", "excluded", opts.HideExcluded, hidden.Excluded),
+	}, "  "))
+}
+
 func nodesToItems(nodes []*Node) []list.Item {
 	items := make([]list.Item, len(nodes))
 	for i, n := range nodes {
@@ -517,6 +1533,7 @@ func (m model) renderTitleView() string {
 		{"enter", "Browse files"},
 		{"s", "Search files"},
 		{"?", "Settings / Roadmap"},
+		{"i", "Filename index"},
 		{"q", "Quit"},
 	}
 
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Properties is everything the Properties view shows about one entry.
+type Properties struct {
+	NodeMetadata
+
+	// Owner and Group are names, or the numeric ids when there is no name
+	Owner, Group string
+	// DevString is the device as major:minor
+	DevString  string
+	FSType     string
+	MountPoint string
+}
+
+type propsModel struct {
+	node  *Node
+	props *Properties
+	err   error
+}
+
+// loadProperties stats n on the local disk. Other backends only know what
+// the node already carries.
+func loadProperties(n *Node) (*Properties, error) {
+	if !isLocal(n.FS()) {
+		meta, err := NewNodeMetadataFS(n.FS(), n.metadata.Path)
+		if err != nil {
+			return nil, err
+		}
+		props := &Properties{NodeMetadata: *meta}
+		if a, ok := n.FS().(*archiveFS); ok {
+			props.FSType, props.MountPoint = a.format.name, a.mount
+			if info, err := a.Lstat(n.metadata.Path); err == nil {
+				if e, ok := info.Sys().(*archiveEntry); ok {
+					props.Owner, props.Group = e.owner, e.group
+				}
+			}
+		}
+		return props, nil
+	}
+	return LoadProperties(n.metadata.Path)
+}
+
+func lookupUser(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+func lookupGroup(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// showProperties loads the properties of n and switches to their view.
+func (m *model) showProperties(n *Node) {
+	props, err := loadProperties(n)
+	m.props = propsModel{node: n, props: props, err: err}
+	m.views.Push(m.currentView)
+	m.currentView = propsView
+}
+
+func (m *model) updatePropsView(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			if view, ok := m.views.Pop(); ok {
+				m.currentView = view
+			}
+		case "r":
+			if m.props.node != nil {
+				props, err := loadProperties(m.props.node)
+				m.props = propsModel{node: m.props.node, props: props, err: err}
+			}
+		}
+	}
+	return nil
+}
+
+func (m model) renderPropsView() string {
+	var s strings.Builder
+	s.WriteString(headerStyle.Render("Properties") + "\n")
+
+	if m.props.err != nil {
+		s.WriteString(highPriorityStyle.Render("✗ "+m.props.err.Error()) + "\n")
+		s.WriteString("\n" + titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back"))
+		return docStyle.Render(s.String())
+	}
+
+	p := m.props.props
+	row := func(label, value string) {
+		s.WriteString(fmt.Sprintf("%s %s\n", titleMutedStyle.Render(fmt.Sprintf("%-12s", label)), value))
+	}
+	stamp := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+	orDash := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+
+	row("Path", titlePathStyle.Render(p.Path))
+	if p.IsSymlink {
+		row("Link to", p.LinkTarget)
+	}
+	row("Type", fileTypeName(p.Mode))
+	row("Mode", fmt.Sprintf("%s (%04o)", p.Mode, octalMode(p.Mode)))
+	row("Size", fmt.Sprintf("%s (%d bytes)", formatSize(p.Size), p.Size))
+	if p.PackedSize > 0 {
+		row("Packed", fmt.Sprintf("%s (%d bytes)", formatSize(p.PackedSize), p.PackedSize))
+	}
+	row("Owner", fmt.Sprintf("%s (%d)", orDash(p.Owner), p.Uid))
+	row("Group", fmt.Sprintf("%s (%d)", orDash(p.Group), p.Gid))
+	row("Inode", fmt.Sprint(p.Inode))
+	row("Links", fmt.Sprint(p.Nlink))
+	row("Device", orDash(p.DevString))
+	row("Modified", stamp(p.ModTime))
+	row("Accessed", stamp(p.AccessTime))
+	row("Changed", stamp(p.ChangeTime))
+	row("Filesystem", orDash(p.FSType))
+	row("Mount point", orDash(p.MountPoint))
+
+	s.WriteString("\n")
+	s.WriteString(titleAccentStyle.Render("r") + titleMutedStyle.Render(" refresh  "))
+	s.WriteString(titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back"))
+	return docStyle.Render(s.String())
+}
+
+// octalMode gives the permission bits the way chmod takes them.
+func octalMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+func fileTypeName(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	}
+	return "regular file"
+}
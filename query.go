@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed search query. Plain words match the file name, filters
+// look at the node metadata:
+//
+//	ext:go          extension, several can be given as ext:go,md
+//	size:>10M       size with <, <=, >, >=, = and B/K/M/G/T units
+//	modified:<7d    age with s/m/h/d/w/y units, or a date like 2024-01-31
+//	type:dir        dir or file
+//	name:/regex/    regular expression on the name, name:word is a plain word
+//
+// Terms next to each other are ANDed. AND, OR, NOT and parentheses combine
+// them explicitly; NOT binds tightest, then AND, then OR.
+type Query struct {
+	expr  queryExpr
+	words []string // positive plain words, used for scoring and highlighting
+}
+
+// queryExpr is one node of the parsed query tree.
+type queryExpr interface {
+	eval(c *matchContext) bool
+}
+
+// matchContext is what a queryExpr gets to look at for a single node.
+type matchContext struct {
+	meta  *NodeMetadata
+	name  string
+	fuzzy bool
+	now   time.Time
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ inner queryExpr }
+type matchAll struct{}
+
+func (e andExpr) eval(c *matchContext) bool { return e.left.eval(c) && e.right.eval(c) }
+func (e orExpr) eval(c *matchContext) bool  { return e.left.eval(c) || e.right.eval(c) }
+func (e notExpr) eval(c *matchContext) bool { return !e.inner.eval(c) }
+func (matchAll) eval(*matchContext) bool    { return true }
+
+type wordTerm struct{ word string }
+
+func (t wordTerm) eval(c *matchContext) bool {
+	_, _, ok := matchName(c.name, t.word, c.fuzzy)
+	return ok
+}
+
+type regexTerm struct{ re *regexp.Regexp }
+
+func (t regexTerm) eval(c *matchContext) bool { return t.re.MatchString(c.name) }
+
+type extTerm struct{ exts []string }
+
+func (t extTerm) eval(c *matchContext) bool {
+	if c.meta.IsDir {
+		return false
+	}
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(c.name)), ".")
+	for _, e := range t.exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+type typeTerm struct{ dir bool }
+
+func (t typeTerm) eval(c *matchContext) bool { return c.meta.IsDir == t.dir }
+
+type sizeTerm struct {
+	op   string
+	size int64
+}
+
+func (t sizeTerm) eval(c *matchContext) bool {
+	return compareInt(c.meta.Size, t.op, t.size)
+}
+
+// modifiedTerm compares either the age of a node (when age is set) or its
+// modification time against a fixed date.
+type modifiedTerm struct {
+	op     string
+	age    time.Duration
+	date   time.Time
+	useAge bool
+}
+
+func (t modifiedTerm) eval(c *matchContext) bool {
+	if t.useAge {
+		return compareInt(int64(c.now.Sub(c.meta.ModTime)), t.op, int64(t.age))
+	}
+	return compareInt(c.meta.ModTime.Unix(), t.op, t.date.Unix())
+}
+
+func compareInt(a int64, op string, b int64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+// ParseQuery parses a search query. An empty query matches everything.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if len(tokens) == 0 {
+		return &Query{expr: matchAll{}}, nil
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	q := &Query{expr: expr}
+	q.words = positiveWords(expr, nil)
+	return q, nil
+}
+
+// Match reports whether the node described by meta and name matches the
+// query. Score and matched rune positions come from the plain words.
+func (q *Query) Match(meta *NodeMetadata, name string, fuzzyMode bool, now time.Time) (int, []int, bool) {
+	c := &matchContext{meta: meta, name: name, fuzzy: fuzzyMode, now: now}
+	if !q.expr.eval(c) {
+		return 0, nil, false
+	}
+
+	score := 0
+	var matches []int
+	seen := map[int]bool{}
+	for _, w := range q.words {
+		s, m, ok := matchName(name, w, fuzzyMode)
+		if !ok {
+			continue
+		}
+		score += s
+		for _, pos := range m {
+			if !seen[pos] {
+				seen[pos] = true
+				matches = append(matches, pos)
+			}
+		}
+	}
+	return score, matches, true
+}
+
+// matchIndexed is Match for what the filename index recorded about a node.
+// Files edited in place keep the mtime of their directory, so the index
+// may hold an old size and modification time; known is false when the
+// result depends on them and the node has to be stat'ed again.
+func (q *Query) matchIndexed(meta *NodeMetadata, name string, fuzzyMode bool, now time.Time) (ok, known bool) {
+	return evalKnown(q.expr, &matchContext{meta: meta, name: name, fuzzy: fuzzyMode, now: now})
+}
+
+// evalKnown evaluates e with size and modified terms unknown, the way SQL
+// treats NULL: AND is false and OR is true as soon as one side decides it.
+func evalKnown(e queryExpr, c *matchContext) (ok, known bool) {
+	switch e := e.(type) {
+	case sizeTerm, modifiedTerm:
+		return false, false
+	case notExpr:
+		ok, known := evalKnown(e.inner, c)
+		return !ok, known
+	case andExpr:
+		l, lk := evalKnown(e.left, c)
+		r, rk := evalKnown(e.right, c)
+		if (lk && !l) || (rk && !r) {
+			return false, true
+		}
+		return true, lk && rk
+	case orExpr:
+		l, lk := evalKnown(e.left, c)
+		r, rk := evalKnown(e.right, c)
+		if (lk && l) || (rk && r) {
+			return true, true
+		}
+		return false, lk && rk
+	}
+	return e.eval(c), true
+}
+
+// positiveWords collects the plain words that are not under a NOT.
+func positiveWords(e queryExpr, words []string) []string {
+	switch e := e.(type) {
+	case wordTerm:
+		return append(words, e.word)
+	case andExpr:
+		return positiveWords(e.right, positiveWords(e.left, words))
+	case orExpr:
+		return positiveWords(e.right, positiveWords(e.left, words))
+	}
+	return words
+}
+
+type queryToken struct {
+	text   string
+	quoted bool // quoted tokens are never keywords or parentheses
+}
+
+// lexQuery splits a query into words and parentheses. Double quotes group
+// words, and a /regex/ value may contain spaces and parentheses.
+func lexQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(s)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, queryToken{text: string(r)})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("missing closing quote")
+			}
+			tokens = append(tokens, queryToken{text: string(runes[i+1 : end]), quoted: true})
+			i = end + 1
+		default:
+			var b strings.Builder
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				if runes[i] == '/' && strings.EqualFold(b.String(), "name:") {
+					end, err := scanRegex(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					b.WriteString(string(runes[i:end]))
+					i = end
+					continue
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, queryToken{text: b.String()})
+		}
+	}
+	return tokens, nil
+}
+
+// scanRegex returns the index just past the closing slash of the regex
+// starting at runes[start].
+func scanRegex(runes []rune, start int) (int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == '/' {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("missing closing / in regex")
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) isKeyword(kw string) bool {
+	t, ok := p.peek()
+	return ok && !t.quoted && t.text == kw
+}
+
+func (p *queryParser) parseOr() (queryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isKeyword("AND") {
+			p.pos++
+		} else if _, ok := p.peek(); !ok || p.isKeyword("OR") || p.isKeyword(")") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+}
+
+func (p *queryParser) parseNot() (queryExpr, error) {
+	if p.isKeyword("NOT") {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryExpr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("query ends too early")
+	}
+	if t.quoted {
+		p.pos++
+		return wordTerm{t.text}, nil
+	}
+	switch t.text {
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return expr, nil
+	case ")", "AND", "OR":
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	p.pos++
+	return parseTerm(t.text)
+}
+
+// parseTerm turns a single word into a filter or a plain name match.
+func parseTerm(s string) (queryExpr, error) {
+	key, value, found := strings.Cut(s, ":")
+	if !found {
+		return wordTerm{s}, nil
+	}
+	switch strings.ToLower(key) {
+	case "ext":
+		var exts []string
+		for _, e := range strings.Split(value, ",") {
+			e = strings.TrimPrefix(strings.ToLower(e), ".")
+			if e != "" {
+				exts = append(exts, e)
+			}
+		}
+		if len(exts) == 0 {
+			return nil, fmt.Errorf("ext: needs an extension")
+		}
+		return extTerm{exts}, nil
+	case "type":
+		switch strings.ToLower(value) {
+		case "dir", "d", "directory":
+			return typeTerm{dir: true}, nil
+		case "file", "f":
+			return typeTerm{dir: false}, nil
+		}
+		return nil, fmt.Errorf("type: want dir or file, got %q", value)
+	case "size":
+		op, rest := splitOperator(value)
+		size, err := parseSize(rest)
+		if err != nil {
+			return nil, err
+		}
+		return sizeTerm{op: op, size: size}, nil
+	case "modified", "mtime":
+		op, rest := splitOperator(value)
+		if date, err := time.ParseInLocation("2006-01-02", rest, time.Local); err == nil {
+			return modifiedTerm{op: op, date: date}, nil
+		}
+		age, err := parseAge(rest)
+		if err != nil {
+			return nil, err
+		}
+		return modifiedTerm{op: op, age: age, useAge: true}, nil
+	case "name":
+		if len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+			re, err := regexp.Compile(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("name: %v", err)
+			}
+			return regexTerm{re}, nil
+		}
+		if value == "" {
+			return nil, fmt.Errorf("name: needs a value")
+		}
+		return wordTerm{value}, nil
+	}
+	// not a filter we know, so "a:b" is just part of a name
+	return wordTerm{s}, nil
+}
+
+func splitOperator(s string) (string, string) {
+	for _, op := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			return op, s[len(op):]
+		}
+	}
+	return "=", s
+}
+
+// parseSize reads sizes like 512, 10K, 1.5MB or 2g using 1024 based units,
+// the same as formatSize.
+func parseSize(s string) (int64, error) {
+	upper := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if n := len(upper); n > 0 {
+		if i := strings.IndexByte("KMGTP", upper[n-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			upper = upper[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(upper, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("size: %q is not a size", s)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+// parseAge reads ages like 30s, 15m, 2h, 7d, 3w or 1y.
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	if len(s) < 2 {
+		return 0, fmt.Errorf("modified: %q is not an age or date", s)
+	}
+	unit, ok := units[strings.ToLower(s[len(s)-1:])]
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("modified: %q is not an age or date", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
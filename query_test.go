@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuery_Match(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	goFile := &NodeMetadata{Name: "main.go", Size: 2048, ModTime: now.Add(-2 * 24 * time.Hour)}
+	bigLog := &NodeMetadata{Name: "server.log", Size: 50 << 20, ModTime: now.Add(-30 * 24 * time.Hour)}
+	srcDir := &NodeMetadata{Name: "src", IsDir: true, ModTime: now}
+
+	tests := []struct {
+		query string
+		meta  *NodeMetadata
+		want  bool
+	}{
+		{"", goFile, true},
+		{"main", goFile, true},
+		{"ext:go", goFile, true},
+		{"ext:.GO", goFile, true},
+		{"ext:md,go", goFile, true},
+		{"ext:go", srcDir, false},
+		{"size:>10M", bigLog, true},
+		{"size:>10M", goFile, false},
+		{"size:<=2K", goFile, true},
+		{"size:2048", goFile, true},
+		{"modified:<7d", goFile, true},
+		{"modified:<7d", bigLog, false},
+		{"modified:>1w", bigLog, true},
+		{"modified:<2025-05-10", bigLog, true},
+		{"modified:>2025-05-10", bigLog, false},
+		{"type:dir", srcDir, true},
+		{"type:file", srcDir, false},
+		{"name:/^ma.n\\.go$/", goFile, true},
+		{"name:/^ma.n\\.go$/", bigLog, false},
+		{"main ext:go", goFile, true},
+		{"main AND ext:md", goFile, false},
+		{"ext:md OR ext:go", goFile, true},
+		{"NOT ext:go", goFile, false},
+		{"NOT type:dir size:>1M", bigLog, true},
+		{"(ext:log OR ext:go) AND NOT size:>10M", bigLog, false},
+		{"(ext:log OR ext:go) AND NOT size:>10M", goFile, true},
+		{`"main.go"`, goFile, true},
+		{"foo:bar", goFile, false},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		_, _, got := q.Match(tt.meta, tt.meta.Name, false, now)
+		if got != tt.want {
+			t.Errorf("%q on %s = %v, want %v", tt.query, tt.meta.Name, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	bad := []string{
+		"size:>lots",
+		"modified:<soon",
+		"type:socket",
+		"name:/[/",
+		"name:/unterminated",
+		"(ext:go",
+		"ext:go)",
+		"ext:go OR",
+		"NOT",
+		`"open quote`,
+		"ext:",
+	}
+	for _, query := range bad {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded, want an error", query)
+		}
+	}
+}
+
+func TestQuery_HighlightsPositiveWordsOnly(t *testing.T) {
+	q, err := ParseQuery("zip NOT test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &NodeMetadata{Name: "zip_engine.go"}
+	_, matches, ok := q.Match(meta, meta.Name, false, time.Now())
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if len(matches) != 3 || matches[0] != 0 || matches[2] != 2 {
+		t.Errorf("matches = %v, want [0 1 2]", matches)
+	}
+}
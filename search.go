@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// SearchOptions controls how far Engine.Search looks.
+type SearchOptions struct {
+	Recursive bool
+	Fuzzy     bool // rank by fuzzy score instead of plain substring matching
+	MaxDepth  int  // 0 means no limit
+	Limit     int  // 0 means no limit
+	Workers   int
+}
+
+// SearchResult is a single hit together with its path relative to the
+// directory the search was started from.
+type SearchResult struct {
+	Node    *Node
+	RelPath string
+	Score   int
+	// Matches holds the rune positions in the base name that matched the
+	// query, for highlighting.
+	Matches []int
+}
+
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{
+		Recursive: false,
+		MaxDepth:  12,
+		Limit:     500,
+		Workers:   4,
+	}
+}
+
+// Search looks for query in the current directory, or in the whole subtree
+// below it when opts.Recursive is set. The query syntax is described on
+// Query. A recursive search stops early when ctx is cancelled or opts.Limit
+// results have been found. A fuzzy one has to see every match to know the
+// best, so it walks the whole subtree and keeps the opts.Limit best.
+func (e *Engine) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	e.mu.Lock()
+	root := e.current
+	index := e.index
+	e.mu.Unlock()
+
+	// the index only knows the local disk
+	if opts.Recursive && index != nil && isLocal(root.FS()) && index.Fresh(root.metadata.Path) {
+		return e.searchIndex(ctx, root, q, opts, now)
+	}
+
+	if !opts.Recursive {
+		var results []SearchResult
+		// go through current directory and find matching files
+		for _, child := range root.Children() {
+			name := filepath.Base(child.metadata.Path)
+			if score, matches, ok := q.Match(child.metadata, name, opts.Fuzzy, now); ok {
+				results = append(results, SearchResult{Node: child, RelPath: name, Score: score, Matches: matches})
+			}
+		}
+		rankResults(results, opts)
+		return results, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		results []SearchResult
+	)
+	err = walkTree(ctx, root, opts.Workers, opts.MaxDepth, func(n *Node, rel string, depth int) bool {
+		score, matches, ok := q.Match(n.metadata, filepath.Base(rel), opts.Fuzzy, now)
+		if !ok {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if opts.Fuzzy {
+			results = append(results, SearchResult{Node: n, RelPath: rel, Score: score, Matches: matches})
+			// drop the worst now and then, so memory stays bounded
+			if opts.Limit > 0 && len(results) >= 2*opts.Limit {
+				rankResults(results, opts)
+				results = results[:opts.Limit]
+			}
+			return true
+		}
+		if opts.Limit > 0 && len(results) >= opts.Limit {
+			return false
+		}
+		results = append(results, SearchResult{Node: n, RelPath: rel, Score: score, Matches: matches})
+		if opts.Limit > 0 && len(results) >= opts.Limit {
+			cancel()
+		}
+		return true
+	})
+
+	// hitting the limit cancels the walk, that is not an error for the caller
+	if !opts.Fuzzy && opts.Limit > 0 && len(results) >= opts.Limit {
+		err = nil
+	}
+	rankResults(results, opts)
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, err
+}
+
+// matchName reports whether name matches query. For fuzzy searches the score
+// says how good the match is; in both modes the matched rune positions are
+// returned.
+func matchName(name, query string, fuzzyMode bool) (int, []int, bool) {
+	if !fuzzyMode || query == "" {
+		// lowering can change byte lengths, so count runes in what was searched
+		lower := strings.ToLower(name)
+		idx := strings.Index(lower, strings.ToLower(query))
+		if idx < 0 {
+			return 0, nil, false
+		}
+		start := utf8.RuneCountInString(lower[:idx])
+		matches := make([]int, utf8.RuneCountInString(query))
+		for i := range matches {
+			matches[i] = start + i
+		}
+		return 0, matches, true
+	}
+
+	found := fuzzy.Find(query, []string{name})
+	if len(found) == 0 {
+		return 0, nil, false
+	}
+	// fuzzy reports byte offsets, the list delegate wants rune positions
+	matches := make([]int, len(found[0].MatchedIndexes))
+	for i, b := range found[0].MatchedIndexes {
+		matches[i] = utf8.RuneCountInString(name[:b])
+	}
+	return found[0].Score, matches, true
+}
+
+// rankResults orders fuzzy results best first. Ties, and all plain
+// substring results, are ordered by path so the output is stable.
+func rankResults(results []SearchResult, opts SearchOptions) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if opts.Fuzzy && results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].RelPath < results[j].RelPath
+	})
+}
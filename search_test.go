@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// makeTree creates the given files (and their parent directories) below a
+// fresh temp directory and returns its path.
+func makeTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func relPaths(results []SearchResult) []string {
+	var paths []string
+	for _, r := range results {
+		paths = append(paths, filepath.ToSlash(r.RelPath))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSearch_CurrentFolderOnly(t *testing.T) {
+	fsys, root := makeMemTree(t, "notes.txt", "sub/notes.md")
+	engine := newMemEngine(t, fsys, root)
+
+	results, err := engine.Search(context.Background(), "notes", DefaultSearchOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relPaths(results)
+	if len(got) != 1 || got[0] != "notes.txt" {
+		t.Errorf("got %v, want [notes.txt]", got)
+	}
+}
+
+func TestSearch_Recursive(t *testing.T) {
+	fsys, root := makeMemTree(t, "notes.txt", "sub/notes.md", "sub/deeper/NOTES", "sub/other.go")
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	results, err := engine.Search(context.Background(), "notes", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relPaths(results)
+	want := []string{"notes.txt", "sub/deeper/NOTES", "sub/notes.md"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSearch_MaxDepth(t *testing.T) {
+	fsys, root := makeMemTree(t, "a.txt", "one/a.txt", "one/two/a.txt")
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	opts.MaxDepth = 2
+	results, err := engine.Search(context.Background(), "a.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("got %v, want 2 results", relPaths(results))
+	}
+}
+
+func TestSearch_Limit(t *testing.T) {
+	fsys, root := makeMemTree(t, "a1", "a2", "d/a3", "d/a4", "d/e/a5")
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	opts.Limit = 3
+	results, err := engine.Search(context.Background(), "a", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("got %d results, want 3", len(results))
+	}
+}
+
+func TestSearch_Cancelled(t *testing.T) {
+	fsys, root := makeMemTree(t, "a", "b/c")
+	engine := newMemEngine(t, fsys, root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	if _, err := engine.Search(ctx, "a", opts); err == nil {
+		t.Error("expected an error for a cancelled search")
+	}
+}
+
+func TestSearch_FuzzyRanking(t *testing.T) {
+	fsys, root := makeMemTree(t, "model.go", "xamxoxdx.txt", "readme.md")
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Fuzzy = true
+	results, err := engine.Search(context.Background(), "mod", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := relPaths(results)
+	if len(got) != 2 {
+		t.Fatalf("got %v, want 2 results", got)
+	}
+	if results[0].RelPath != "model.go" {
+		t.Errorf("best match = %s, want model.go", results[0].RelPath)
+	}
+	if results[0].Score < results[1].Score {
+		t.Errorf("results not ordered by score: %d < %d", results[0].Score, results[1].Score)
+	}
+}
+
+func TestSearch_FuzzyLimitKeepsBest(t *testing.T) {
+	fsys, root := makeMemTree(t, "a/xmxoxdx1.txt", "a/xmxoxdx2.txt", "a/xmxoxdx3.txt", "z/deep/model.go")
+	engine := newMemEngine(t, fsys, root)
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	opts.Fuzzy = true
+	opts.Limit = 2
+	results, err := engine.Search(context.Background(), "mod", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].RelPath != filepath.Join("z", "deep", "model.go") {
+		t.Errorf("got %v, want z/deep/model.go first of 2", relPaths(results))
+	}
+}
+
+func TestMatchName_Positions(t *testing.T) {
+	tests := []struct {
+		name, query string
+		fuzzy       bool
+		want        []int
+	}{
+		{"README.md", "read", false, []int{0, 1, 2, 3}},
+		{"main.go", "go", false, []int{5, 6}},
+		{"zip_engine.go", "zeg", true, []int{0, 4, 11}},
+		{"ñandú.txt", "dú", false, []int{3, 4}},
+		{"ñandú.txt", "dt", true, []int{3, 6}},
+		{"İstanbul.txt", "bul", false, []int{5, 6, 7}},
+	}
+	for _, tt := range tests {
+		_, got, ok := matchName(tt.name, tt.query, tt.fuzzy)
+		if !ok {
+			t.Errorf("matchName(%q, %q) did not match", tt.name, tt.query)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("matchName(%q, %q) = %v, want %v", tt.name, tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("matchName(%q, %q) = %v, want %v", tt.name, tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
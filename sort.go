@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SortKey is what a directory listing is ordered by.
+type SortKey int
+
+const (
+	SortName SortKey = iota
+	SortSize
+	SortModTime
+	SortExt
+	SortType
+	sortKeyCount
+)
+
+var sortKeyNames = [...]string{"name", "size", "mtime", "ext", "type"}
+
+func (k SortKey) String() string {
+	if k < 0 || k >= sortKeyCount {
+		return fmt.Sprintf("SortKey(%d)", int(k))
+	}
+	return sortKeyNames[k]
+}
+
+// Next cycles through the sort keys in the order the file view offers them.
+func (k SortKey) Next() SortKey {
+	return (k + 1) % sortKeyCount
+}
+
+func (k SortKey) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *SortKey) UnmarshalText(text []byte) error {
+	for i, name := range sortKeyNames {
+		if string(text) == name {
+			*k = SortKey(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sort key %q", text)
+}
+
+// SortMode is how one directory is listed. Reverse flips the order of the
+// key, DirsFirst keeps directories above files whatever the key.
+type SortMode struct {
+	Key       SortKey `json:"key"`
+	Reverse   bool    `json:"reverse,omitempty"`
+	DirsFirst bool    `json:"dirs_first,omitempty"`
+}
+
+// DefaultSortMode is used for directories without a remembered mode.
+var DefaultSortMode = SortMode{Key: SortName, DirsFirst: true}
+
+func (s SortMode) String() string {
+	arrow := "↑"
+	if s.Reverse {
+		arrow = "↓"
+	}
+	str := s.Key.String() + " " + arrow
+	if s.DirsFirst {
+		str += ", dirs first"
+	}
+	return str
+}
+
+// sortNodes returns nodes ordered by mode. nodes itself is left alone, it is
+// usually a directory's children snapshot.
+func sortNodes(nodes []*Node, mode SortMode) []*Node {
+	sorted := make([]*Node, len(nodes))
+	copy(sorted, nodes)
+	// directory totals sit behind node locks, read them once
+	var sizes map[*Node]int64
+	if mode.Key == SortSize {
+		sizes = make(map[*Node]int64, len(sorted))
+		for _, n := range sorted {
+			sizes[n] = nodeSize(n)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].metadata, sorted[j].metadata
+		if mode.DirsFirst && a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		var c int
+		if mode.Key == SortSize {
+			c = compareInt64(sizes[sorted[i]], sizes[sorted[j]])
+		}
+		if c == 0 {
+			c = compareBy(mode.Key, a, b)
+		}
+		if mode.Reverse {
+			c = -c
+		}
+		return c < 0
+	})
+	return sorted
+}
+
+// nodeSize is the measured total of a directory, or the size stat gave.
+func nodeSize(n *Node) int64 {
+	if n.metadata.IsDir {
+		if u, ok := n.Usage(); ok {
+			return u.Size
+		}
+	}
+	return n.metadata.Size
+}
+
+// compareBy orders a and b by key, falling back to their names on a tie so
+// the listing never shuffles.
+func compareBy(key SortKey, a, b *NodeMetadata) int {
+	c := 0
+	switch key {
+	case SortSize:
+		c = compareInt64(a.Size, b.Size)
+	case SortModTime:
+		c = a.ModTime.Compare(b.ModTime)
+	case SortExt:
+		c = strings.Compare(sortExt(a), sortExt(b))
+	case SortType:
+		c = typeRank(a) - typeRank(b)
+		if c == 0 {
+			c = strings.Compare(sortExt(a), sortExt(b))
+		}
+	}
+	if c == 0 {
+		c = naturalCompare(filepath.Base(a.Path), filepath.Base(b.Path))
+	}
+	return c
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sortExt(m *NodeMetadata) string {
+	if m.IsDir {
+		return ""
+	}
+	return strings.ToLower(filepath.Ext(m.Path))
+}
+
+// typeRank groups directories, then links, then regular files, then
+// everything else.
+func typeRank(m *NodeMetadata) int {
+	switch {
+	case m.IsDir:
+		return 0
+	case m.IsSymlink:
+		return 1
+	case m.Mode.IsRegular() || m.Mode == 0:
+		return 2
+	}
+	return 3
+}
+
+// naturalCompare compares names case insensitively with runs of digits
+// compared as numbers, so file2 comes before file10.
+func naturalCompare(a, b string) int {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	i, j := 0, 0
+	for i < len(la) && j < len(lb) {
+		ca, cb := la[i], lb[j]
+		if isDigit(ca) && isDigit(cb) {
+			si, sj := i, j
+			for i < len(la) && isDigit(la[i]) {
+				i++
+			}
+			for j < len(lb) && isDigit(lb[j]) {
+				j++
+			}
+			na := strings.TrimLeft(la[si:i], "0")
+			nb := strings.TrimLeft(lb[sj:j], "0")
+			if len(na) != len(nb) {
+				return compareInt64(int64(len(na)), int64(len(nb)))
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if ca != cb {
+			return compareInt64(int64(ca), int64(cb))
+		}
+		i++
+		j++
+	}
+	if c := compareInt64(int64(len(la)-i), int64(len(lb)-j)); c != 0 {
+		return c
+	}
+	// equal apart from case or leading zeros, keep it deterministic
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// SortPrefs remembers the sort mode of every directory the user changed it
+// in, and keeps them in a JSON file so they survive restarts. Directories
+// are keyed by nodeLocation, so a share and the local disk stay apart.
+type SortPrefs struct {
+	mu   sync.Mutex
+	path string
+	dirs map[string]SortMode
+}
+
+func DefaultSortPrefsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appName, "sort.json"), nil
+}
+
+// OpenSortPrefs loads the modes stored at path. A missing or broken file
+// gives no remembered modes; an empty path keeps them in memory only.
+func OpenSortPrefs(path string) *SortPrefs {
+	p := &SortPrefs{path: path, dirs: map[string]SortMode{}}
+	if path == "" {
+		return p
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p
+	}
+	var dirs map[string]SortMode
+	if json.Unmarshal(data, &dirs) == nil && dirs != nil {
+		p.dirs = dirs
+	}
+	return p
+}
+
+// Get returns the mode for the directory at location.
+func (p *SortPrefs) Get(location string) SortMode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if mode, ok := p.dirs[location]; ok {
+		return mode
+	}
+	return DefaultSortMode
+}
+
+// Set remembers mode for the directory at location and saves the file.
+func (p *SortPrefs) Set(location string, mode SortMode) error {
+	p.mu.Lock()
+	if mode == DefaultSortMode {
+		delete(p.dirs, location)
+	} else {
+		p.dirs[location] = mode
+	}
+	data, err := json.MarshalIndent(p.dirs, "", "  ")
+	p.mu.Unlock()
+	if err != nil || p.path == "" {
+		return err
+	}
+	return writeFileAtomic(p.path, data)
+}
+
+// writeFileAtomic replaces path with data, so a crash never leaves half a
+// file behind.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func names(nodes []*Node) string {
+	var s []string
+	for _, n := range nodes {
+		s = append(s, filepath.Base(n.metadata.Path))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestNaturalCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"file2", "file10", -1},
+		{"file10", "file2", 1},
+		{"File2", "file3", -1},
+		{"a", "a1", -1},
+		{"x007", "x7b", -1},
+		{"img12.png", "img12.jpg", 1},
+		{"same", "same", 0},
+	} {
+		if got := naturalCompare(tc.a, tc.b); got != tc.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSortNodes(t *testing.T) {
+	fsys, root := makeMemTree(t, "file10.txt", "file2.txt", "b.go", "dir1/x", "Dir2/x")
+	if err := fsys.WriteFile(filepath.Join(root, "b.go"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Chtimes(filepath.Join(root, "file10.txt"), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	children := newMemEngine(t, fsys, root).current.Children()
+
+	for _, tc := range []struct {
+		mode SortMode
+		want string
+	}{
+		{DefaultSortMode, "dir1 Dir2 b.go file2.txt file10.txt"},
+		{SortMode{Key: SortName}, "b.go dir1 Dir2 file2.txt file10.txt"},
+		{SortMode{Key: SortName, Reverse: true, DirsFirst: true}, "Dir2 dir1 file10.txt file2.txt b.go"},
+		{SortMode{Key: SortSize, Reverse: true, DirsFirst: true}, "Dir2 dir1 b.go file10.txt file2.txt"},
+		{SortMode{Key: SortModTime, DirsFirst: true}, "dir1 Dir2 file10.txt b.go file2.txt"},
+		{SortMode{Key: SortExt}, "dir1 Dir2 b.go file2.txt file10.txt"},
+	} {
+		got := names(sortNodes(children, tc.mode))
+		// files written in the same instant can share an mtime
+		if tc.mode.Key == SortModTime {
+			got = strings.Replace(got, "file2.txt b.go", "b.go file2.txt", 1)
+		}
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+	if names(children) != "Dir2 b.go dir1 file10.txt file2.txt" {
+		t.Errorf("sortNodes changed its input: %q", names(children))
+	}
+}
+
+func TestSortPrefs_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sort.json")
+	prefs := OpenSortPrefs(path)
+	mode := SortMode{Key: SortSize, Reverse: true}
+	if err := prefs.Set("/a", mode); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := OpenSortPrefs(path)
+	if got := reopened.Get("/a"); got != mode {
+		t.Errorf("got %+v, want %+v", got, mode)
+	}
+	if got := reopened.Get("/b"); got != DefaultSortMode {
+		t.Errorf("unset directory got %+v", got)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"size"`) {
+		t.Errorf("sort keys should be stored by name: %s", data)
+	}
+}
+
+func TestEngine_SortModeKeepsSharesApart(t *testing.T) {
+	_, location := startDAV(t, "docs/a.txt")
+	engine, err := OpenEngine(strings.Replace(location, "webdav://", "webdav://ann:secret@", 1)+"/tree", &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs := OpenSortPrefs("")
+	engine.SetSortPrefs(prefs)
+
+	mode := SortMode{Key: SortSize}
+	if err := engine.SetSortMode(mode); err != nil {
+		t.Fatal(err)
+	}
+	if got := prefs.Get("/tree"); got != DefaultSortMode {
+		t.Errorf("local /tree got %+v from the share", got)
+	}
+	if got := prefs.Get(location + "/tree"); got != mode {
+		t.Errorf("share /tree got %+v, want %+v", got, mode)
+	}
+}
+
+func TestEngine_ListAndEnterFollowSortMode(t *testing.T) {
+	fsys, root := makeMemTree(t, "a.txt", "zdir/x")
+	engine := newMemEngine(t, fsys, root)
+
+	if err := engine.SetSortMode(SortMode{Key: SortName}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := engine.List()
+	if names(list) != "a.txt zdir" {
+		t.Fatalf("list = %q", names(list))
+	}
+	if err := engine.Enter(0); err == nil {
+		t.Error("entering a.txt should fail")
+	}
+
+	if err := engine.SetSortMode(DefaultSortMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Enter(0); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(engine.current.metadata.Path) != "zdir" {
+		t.Errorf("entered %s, want zdir", engine.current.metadata.Path)
+	}
+}
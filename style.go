@@ -134,6 +134,11 @@ var (
 
 	lowPriorityStyle = lipgloss.NewStyle().
 				Foreground(colorGray)
+
+	// Search view: characters that matched the query
+	searchMatchStyle = lipgloss.NewStyle().
+				Foreground(colorOrange).
+				Bold(true)
 )
 var docStyle = lipgloss.NewStyle().Margin(1, 2)
 var (
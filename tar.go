@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// tarDecompressor unwraps the compression around a tar stream.
+type tarDecompressor func(r io.Reader) (io.Reader, error)
+
+func plainTar(r io.Reader) (io.Reader, error) { return r, nil }
+func gzipTar(r io.Reader) (io.Reader, error)  { return gzip.NewReader(r) }
+func bzip2Tar(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }
+
+// tarReader returns a tar format that unwraps with decompress.
+func tarReader(decompress tarDecompressor) func(fsys FS, path string) (*archiveEntry, io.Closer, error) {
+	return func(fsys FS, path string) (*archiveEntry, io.Closer, error) {
+		return readTar(fsys, path, decompress)
+	}
+}
+
+// readTar builds the tree of the tar at path from its headers, reading the
+// stream once. Contents are not kept: opening an entry reads the stream
+// again up to it.
+func readTar(fsys FS, archive string, decompress tarDecompressor) (*archiveEntry, io.Closer, error) {
+	f, err := fsys.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := decompress(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stream := &tarSource{fsys: fsys, archive: archive, decompress: decompress}
+	root := newArchiveDir(info.ModTime())
+	// hard links share the contents of an earlier entry
+	entries := map[string]*archiveEntry{}
+	var links []*tar.Header
+	linked := map[*tar.Header]*archiveEntry{}
+	tr := tar.NewReader(r)
+	for index := 0; ; index++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		e := &archiveEntry{
+			mode:    hdr.FileInfo().Mode(),
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+			uid:     hdr.Uid,
+			gid:     hdr.Gid,
+			owner:   hdr.Uname,
+			group:   hdr.Gname,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.size = 0
+		case tar.TypeSymlink:
+			e.target = hdr.Linkname
+		case tar.TypeLink:
+			links = append(links, hdr)
+			linked[hdr] = e
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			e.open, e.stream, e.index = stream.entry(index), stream, index
+		}
+		entries[path.Clean(hdr.Name)] = e
+		root.add(hdr.Name, e)
+	}
+	for _, hdr := range links {
+		if target, ok := entries[path.Clean(hdr.Linkname)]; ok {
+			e := linked[hdr]
+			e.size, e.open, e.stream, e.index = target.size, target.open, target.stream, target.index
+		}
+	}
+	return root, nil, nil
+}
+
+// tarSource is a tar file on fsys and how to unwrap it.
+type tarSource struct {
+	fsys       FS
+	archive    string
+	decompress tarDecompressor
+}
+
+// reader starts reading the stream. The caller closes the file.
+func (s *tarSource) reader() (*tar.Reader, fs.File, error) {
+	f, err := s.fsys.Open(s.archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(r), f, nil
+}
+
+// entry returns an opener for the index-th entry of the tar.
+func (s *tarSource) entry(index int) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		tr, f, err := s.reader()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i <= index; i++ {
+			if _, err := tr.Next(); err != nil {
+				f.Close()
+				if err == io.EOF {
+					err = errors.New("entry missing from the archive")
+				}
+				return nil, err
+			}
+		}
+		return tarEntryReader{Reader: tr, file: f}, nil
+	}
+}
+
+// each reads the stream once and calls fn with the contents of every
+// entry whose index is a key of wanted, in stream order.
+func (s *tarSource) each(wanted map[int][]string, fn func(index int, r io.Reader) error) error {
+	last := -1
+	for index := range wanted {
+		last = max(last, index)
+	}
+	tr, f, err := s.reader()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for index := 0; index <= last; index++ {
+		if _, err := tr.Next(); err != nil {
+			if err == io.EOF {
+				err = errors.New("entry missing from the archive")
+			}
+			return err
+		}
+		if _, ok := wanted[index]; ok {
+			if err := fn(index, tr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type tarEntryReader struct {
+	io.Reader
+	file fs.File
+}
+
+func (r tarEntryReader) Close() error { return r.file.Close() }
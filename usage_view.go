@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// usageBarWidth is how many cells the size bar of a full directory takes
+const usageBarWidth = 20
+
+// usageModel is the disk usage view: the entries of dir ranked by their
+// recursive size, ncdu style.
+type usageModel struct {
+	list list.Model
+	dir  *Node
+
+	seq    int
+	cancel context.CancelFunc
+
+	// confirm is the entry waiting for a y to be deleted
+	confirm *Node
+	err     error
+}
+
+// usageItem is one entry of the disk usage view. share is its part of the
+// directory total, from 0 to 1.
+type usageItem struct {
+	node     *Node
+	size     int64
+	items    int64
+	measured bool
+	share    float64
+}
+
+func (i usageItem) FilterValue() string { return filepath.Base(i.node.metadata.Path) }
+
+// usageDelegate draws one line per entry: bar, percentage, size, item count
+// and name.
+type usageDelegate struct{}
+
+func (d usageDelegate) Height() int                             { return 1 }
+func (d usageDelegate) Spacing() int                            { return 0 }
+func (d usageDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d usageDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
+	it, ok := listItem.(usageItem)
+	if !ok {
+		return
+	}
+	filled := int(it.share*usageBarWidth + 0.5)
+	bar := accentStyle.Render(strings.Repeat("█", filled)) +
+		titleMutedStyle.Render(strings.Repeat("░", usageBarWidth-filled))
+
+	size, items := "…", ""
+	if it.measured {
+		size = formatSize(it.size)
+	}
+	if it.node.metadata.IsDir && it.measured {
+		items = fmt.Sprintf("%d items", it.items)
+	}
+	name := filepath.Base(it.node.metadata.Path)
+	if it.node.metadata.IsDir {
+		name += "/"
+	}
+
+	line := fmt.Sprintf("%9s %5.1f%% %s %11s  ", size, it.share*100, bar, items)
+	cursor := "  "
+	nameStyle := lipgloss.NewStyle()
+	if index == m.Index() {
+		cursor = accentStyle.Render("▌ ")
+		nameStyle = accentStyle
+	}
+	fmt.Fprint(w, cursor+line+nameStyle.Render(truncateRunes(name, max(1, m.Width()-len(line)-2))))
+}
+
+// openUsage shows the disk usage view for dir.
+func (m *model) openUsage(dir *Node) tea.Cmd {
+	m.views.Push(m.currentView)
+	m.currentView = usageView
+	return m.usageEnter(dir)
+}
+
+// usageEnter moves the disk usage view to dir and measures what it shows.
+func (m *model) usageEnter(dir *Node) tea.Cmd {
+	m.stopUsage()
+	m.usage.dir = dir
+	m.usage.confirm = nil
+	m.usage.err = nil
+	cmd := m.usage.list.SetItems(usageItems(dir))
+	m.usage.list.ResetSelected()
+
+	var dirs []*Node
+	for _, n := range dir.Children() {
+		if n.metadata.IsDir && !n.metadata.IsSymlink && !isMountPoint(n) {
+			if _, ok := n.Usage(); !ok {
+				dirs = append(dirs, n)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return cmd
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.usage.cancel = cancel
+	seq := m.usage.seq
+	engine := m.engine
+	workers := m.search.opts.Workers
+	stream := &sizeStream{measured: make(chan *Node, 16), view: usageView}
+	go func() {
+		engine.MeasureDirs(ctx, dirs, workers, stream.measured)
+		close(stream.measured)
+	}()
+	return tea.Batch(cmd, waitForSizes(seq, stream))
+}
+
+// stopUsage cancels the measurement the disk usage view is waiting for.
+func (m *model) stopUsage() {
+	if m.usage.cancel != nil {
+		m.usage.cancel()
+		m.usage.cancel = nil
+	}
+	m.usage.seq++
+}
+
+// usageItems ranks the children of dir by size, biggest first.
+func usageItems(dir *Node) []list.Item {
+	children := dir.Children()
+	entries := make([]usageItem, 0, len(children))
+	var total int64
+	for _, n := range children {
+		it := usageItem{node: n, size: n.metadata.Size, items: 1, measured: true}
+		if n.metadata.IsDir && !n.metadata.IsSymlink {
+			u, ok := n.Usage()
+			it.size, it.items, it.measured = u.Size, u.Files+u.Dirs-1, ok
+		}
+		total += it.size
+		entries = append(entries, it)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].size != entries[j].size {
+			return entries[i].size > entries[j].size
+		}
+		return naturalCompare(filepath.Base(entries[i].node.metadata.Path), filepath.Base(entries[j].node.metadata.Path)) < 0
+	})
+
+	items := make([]list.Item, len(entries))
+	for i, it := range entries {
+		if total > 0 {
+			it.share = float64(it.size) / float64(total)
+		}
+		items[i] = it
+	}
+	return items
+}
+
+// refreshUsage reranks the entries, keeping the cursor on the same one.
+func (m *model) refreshUsage() tea.Cmd {
+	var selected *Node
+	if it, ok := m.usage.list.SelectedItem().(usageItem); ok {
+		selected = it.node
+	}
+	items := usageItems(m.usage.dir)
+	cmd := m.usage.list.SetItems(items)
+	for i, it := range items {
+		if it.(usageItem).node == selected {
+			m.usage.list.Select(i)
+			break
+		}
+	}
+	return cmd
+}
+
+// usageDeletedMsg is sent when a delete started from the disk usage view
+// has finished
+type usageDeletedMsg struct {
+	node *Node
+	err  error
+}
+
+func (m *model) updateUsageView(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case usageDeletedMsg:
+		m.usage.err = msg.err
+		cmd := m.refreshUsage()
+		// the totals above changed, measure again what is missing
+		if msg.node.Parent() == m.usage.dir {
+			return tea.Batch(cmd, m.usageRemeasure())
+		}
+		return cmd
+	case tea.KeyMsg:
+		if m.usage.confirm != nil {
+			n := m.usage.confirm
+			m.usage.confirm = nil
+			if msg.String() != "y" {
+				return nil
+			}
+			engine := m.engine
+			return func() tea.Msg {
+				return usageDeletedMsg{node: n, err: engine.Delete(n)}
+			}
+		}
+		if m.usage.list.FilterState() == list.Filtering {
+			break
+		}
+		switch msg.String() {
+		case "esc", "q":
+			m.stopUsage()
+			if view, ok := m.views.Pop(); ok {
+				m.currentView = view
+			}
+			return nil
+		case "enter", "right", "l":
+			if it, ok := m.usage.list.SelectedItem().(usageItem); ok &&
+				it.node.metadata.IsDir && checkEnter(it.node, false) == nil {
+				return m.usageEnter(it.node)
+			}
+			return nil
+		case "backspace", "left", "h":
+			from := m.usage.dir
+			if parent := from.Parent(); parent != nil {
+				return m.usageUp(from, parent)
+			}
+			return m.readParent(usageView, m.usage.seq, from)
+		case "d", "delete":
+			if it, ok := m.usage.list.SelectedItem().(usageItem); ok {
+				m.usage.confirm = it.node
+				m.usage.err = nil
+			}
+			return nil
+		}
+	}
+	var cmd tea.Cmd
+	m.usage.list, cmd = m.usage.list.Update(msg)
+	return cmd
+}
+
+// usageRemeasure measures the entries of the current usage directory that
+// lost their totals, keeping the cursor where it is.
+func (m *model) usageRemeasure() tea.Cmd {
+	selected := m.usage.list.Index()
+	cmd := m.usageEnter(m.usage.dir)
+	m.usage.list.Select(selected)
+	return cmd
+}
+
+// usageUp shows parent, the cursor on from which the view came up out of.
+func (m *model) usageUp(from, parent *Node) tea.Cmd {
+	cmd := m.usageEnter(parent)
+	for i, it := range m.usage.list.Items() {
+		if it.(usageItem).node == from {
+			m.usage.list.Select(i)
+			break
+		}
+	}
+	return cmd
+}
+
+// usageParentRead goes up once the directory above the view has been read,
+// unless the view moved on meanwhile.
+func (m *model) usageParentRead(msg parentReadMsg) tea.Cmd {
+	if msg.seq != m.usage.seq || msg.from != m.usage.dir || msg.err != nil {
+		return nil
+	}
+	return m.usageUp(msg.from, msg.parent)
+}
+
+// usageSizes handles totals measured for the disk usage view.
+func (m *model) usageSizes(msg dirSizesMsg) tea.Cmd {
+	if msg.seq != m.usage.seq {
+		return nil
+	}
+	return tea.Batch(m.refreshUsage(), waitForSizes(msg.seq, msg.stream))
+}
+
+func (m model) renderUsageView() string {
+	var total, items int64
+	measured := true
+	for _, it := range m.usage.list.Items() {
+		u := it.(usageItem)
+		total += u.size
+		items += u.items
+		measured = measured && u.measured
+	}
+	state := ""
+	if !measured {
+		state = accentStyle.Render(" measuring…")
+	}
+	header := headerStyle.Render("Disk Usage") + " " + titlePathStyle.Render(m.usage.dir.metadata.Path)
+	summary := fmt.Sprintf("%s in %d items", formatSize(total), items) + state
+
+	var footer string
+	switch {
+	case m.usage.confirm != nil:
+		footer = warningStyle.Render(fmt.Sprintf("Delete %s and everything in it? y/n", m.usage.confirm.metadata.Path))
+	case m.usage.err != nil:
+		footer = highPriorityStyle.Render("✗ " + m.usage.err.Error())
+	default:
+		footer = titleAccentStyle.Render("enter") + titleMutedStyle.Render(" open  ") +
+			titleAccentStyle.Render("←") + titleMutedStyle.Render(" up  ") +
+			titleAccentStyle.Render("d") + titleMutedStyle.Render(" delete  ") +
+			titleAccentStyle.Render("esc") + titleMutedStyle.Render(" back")
+	}
+	return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, header, summary, "", m.usage.list.View(), footer))
+}
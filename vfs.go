@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FS is the filesystem a Node tree is read from and written to: the local
+// disk, memory, or the contents of an archive. Names are absolute paths
+// with the host separator, the same strings NodeMetadata.Path holds.
+type FS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	Stat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	// Open opens name for reading. Directories opened with it implement
+	// fs.ReadDirFile.
+	Open(name string) (fs.File, error)
+
+	// Create makes or truncates the file name, it is written on Close.
+	Create(name string) (io.WriteCloser, error)
+	Mkdir(name string, perm fs.FileMode) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+}
+
+// Linker is implemented by filesystems with hard links.
+type Linker interface {
+	Link(oldname, newname string) error
+}
+
+// LocalFS is the operating system's filesystem, the default backend.
+type LocalFS struct{}
+
+var localFS FS = LocalFS{}
+
+func (LocalFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (LocalFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (LocalFS) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (LocalFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (LocalFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+func (LocalFS) Mkdir(name string, perm fs.FileMode) error  { return os.Mkdir(name, perm) }
+func (LocalFS) RemoveAll(name string) error                { return os.RemoveAll(name) }
+func (LocalFS) Rename(oldname, newname string) error       { return os.Rename(oldname, newname) }
+func (LocalFS) Link(oldname, newname string) error         { return os.Link(oldname, newname) }
+func (LocalFS) Symlink(oldname, newname string) error      { return os.Symlink(oldname, newname) }
+func (LocalFS) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+
+// isLocal reports whether fsys is the local disk, which the watcher, the
+// index and the editor need.
+func isLocal(fsys FS) bool {
+	_, ok := fsys.(LocalFS)
+	return ok
+}
+
+// readDir reads the whole directory name, sorted by name like os.ReadDir.
+func readDir(fsys FS, name string) ([]fs.DirEntry, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := dir.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, err
+}
+
+// maxLinkHops is how many symlinks evalSymlinks follows before it calls
+// it a loop
+const maxLinkHops = 40
+
+// evalSymlinks is filepath.EvalSymlinks on fsys.
+func evalSymlinks(fsys FS, name string) (string, error) {
+	if e, ok := fsys.(interface{ EvalSymlinks(string) (string, error) }); ok {
+		return e.EvalSymlinks(name)
+	}
+
+	sep := string(filepath.Separator)
+	resolved := sep
+	rest := strings.Split(strings.Trim(filepath.Clean(name), sep), sep)
+	for hops := 0; len(rest) > 0; {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		info, err := fsys.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxLinkHops {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: errors.New("too many links")}
+		}
+		target, err := fsys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = sep
+		}
+		rest = append(strings.Split(strings.Trim(target, sep), sep), rest...)
+	}
+	return resolved, nil
+}
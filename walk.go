@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+)
+
+// walkFunc is called for every node found below the walk root. rel is the
+// path relative to the root and depth starts at 1 for direct children.
+// Returning false keeps the walker from descending into n.
+type walkFunc func(n *Node, rel string, depth int) bool
+
+type walkJob struct {
+	node  *Node
+	rel   string
+	depth int
+}
+
+// walkTree visits the subtree below root with a bounded pool of workers,
+// loading children on the way. visit is called concurrently from several
+// goroutines. maxDepth <= 0 means no limit.
+func walkTree(ctx context.Context, root *Node, workers, maxDepth int, visit walkFunc) error {
+	return runQueue(ctx, workers, []walkJob{{node: root}}, func(job walkJob) []walkJob {
+		return walkDir(ctx, job, maxDepth, visit)
+	})
+}
+
+// walkDir loads one directory, visits its children and returns the
+// subdirectories that still have to be walked.
+func walkDir(ctx context.Context, job walkJob, maxDepth int, visit walkFunc) []walkJob {
+	var next []walkJob
+	for _, child := range job.node.Children() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		rel := filepath.Join(job.rel, filepath.Base(child.metadata.Path))
+		depth := job.depth + 1
+		if !visit(child, rel, depth) {
+			continue
+		}
+		// links are not followed, they could lead back up the tree
+		if child.metadata.IsDir && !child.metadata.IsSymlink && (maxDepth <= 0 || depth < maxDepth) {
+			next = append(next, walkJob{node: child, rel: rel, depth: depth})
+		}
+	}
+	return next
+}
+
+// runQueue works through a queue of jobs with a bounded pool of workers.
+// process may return more jobs, which are queued in turn. runQueue returns
+// once the queue is drained and every worker is idle, or ctx is done.
+func runQueue[T any](ctx context.Context, workers int, initial []T, process func(T) []T) error {
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var (
+		mu     sync.Mutex
+		cond   = sync.NewCond(&mu)
+		queue  = append([]T(nil), initial...)
+		active int
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(queue) == 0 && active > 0 && ctx.Err() == nil {
+					cond.Wait()
+				}
+				if len(queue) == 0 || ctx.Err() != nil {
+					mu.Unlock()
+					cond.Broadcast()
+					return
+				}
+				job := queue[0]
+				queue = queue[1:]
+				active++
+				mu.Unlock()
+
+				next := process(job)
+
+				mu.Lock()
+				queue = append(queue, next...)
+				active--
+				mu.Unlock()
+				cond.Broadcast()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
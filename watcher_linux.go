@@ -0,0 +1,189 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+// Watcher follows changes to loaded directories with inotify, patches their
+// children and reports every directory it changed on Changes.
+type Watcher struct {
+	fd int
+
+	mu   sync.Mutex
+	dirs map[int]*Node
+	wds  map[*Node]int
+
+	changes chan *Node
+	done    chan struct{}
+	closed  sync.Once
+}
+
+func NewWatcher() (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		fd:      fd,
+		dirs:    map[int]*Node{},
+		wds:     map[*Node]int{},
+		changes: make(chan *Node, 16),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add starts watching the directory n.
+func (w *Watcher) Add(n *Node) error {
+	if !n.metadata.IsDir {
+		return errors.New("not a directory")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.wds[n]; ok {
+		return nil
+	}
+	wd, err := unix.InotifyAddWatch(w.fd, n.metadata.Path, watchMask)
+	if err != nil {
+		return err
+	}
+	// the same directory reached through another node shares its wd
+	if old, ok := w.dirs[wd]; ok {
+		delete(w.wds, old)
+	}
+	w.dirs[wd] = n
+	w.wds[n] = wd
+	return nil
+}
+
+// Remove stops watching n.
+func (w *Watcher) Remove(n *Node) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, ok := w.wds[n]
+	if !ok {
+		return
+	}
+	unix.InotifyRmWatch(w.fd, uint32(wd))
+	delete(w.wds, n)
+	delete(w.dirs, wd)
+}
+
+// Changes delivers the directories whose children were patched.
+func (w *Watcher) Changes() <-chan *Node {
+	return w.changes
+}
+
+func (w *Watcher) Close() error {
+	var err error
+	w.closed.Do(func() {
+		close(w.done)
+		err = unix.Close(w.fd)
+	})
+	return err
+}
+
+func (w *Watcher) run() {
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+		// poll with a timeout so Close is noticed without a read in flight
+		n, err := unix.Poll(fds, 250)
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		nr, err := unix.Read(w.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil || nr <= 0 {
+			return
+		}
+		w.handle(buf[:nr])
+	}
+}
+
+// handle applies one batch of events to the tree and reports each changed
+// directory once.
+func (w *Watcher) handle(buf []byte) {
+	changed := map[*Node]bool{}
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameStart := off + unix.SizeofInotifyEvent
+		off = nameStart + int(ev.Len)
+		if off > len(buf) {
+			break
+		}
+		name := strings.TrimRight(string(buf[nameStart:off]), "\x00")
+
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			for _, dir := range w.watched() {
+				if resyncChildren(dir) {
+					changed[dir] = true
+				}
+			}
+			continue
+		}
+
+		w.mu.Lock()
+		dir := w.dirs[int(ev.Wd)]
+		if ev.Mask&unix.IN_IGNORED != 0 && dir != nil {
+			delete(w.wds, dir)
+			delete(w.dirs, int(ev.Wd))
+		}
+		w.mu.Unlock()
+		if dir == nil {
+			continue
+		}
+
+		switch {
+		case ev.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0:
+			// the parent watch usually says so too, but it may not be watched
+			if parent := dir.Parent(); parent != nil && patchChild(parent, filepath.Base(dir.metadata.Path)) {
+				changed[parent] = true
+			}
+		case name != "":
+			if patchChild(dir, name) {
+				changed[dir] = true
+			}
+		}
+	}
+
+	for dir := range changed {
+		select {
+		case w.changes <- dir:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) watched() []*Node {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	dirs := make([]*Node, 0, len(w.wds))
+	for n := range w.wds {
+		dirs = append(dirs, n)
+	}
+	return dirs
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForDir waits until the watcher reports dir and its children satisfy ok.
+func waitForDir(t *testing.T, e *Engine, dir *Node, ok func([]*Node) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changed := <-e.Changes():
+			if changed == dir && ok(dir.Children()) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a change event")
+		}
+	}
+}
+
+func hasChild(children []*Node, name string) bool {
+	for _, c := range children {
+		if filepath.Base(c.metadata.Path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWatcher_PatchesTree(t *testing.T) {
+	root := makeTree(t, "keep.txt", "sub/inner.txt")
+	engine := NewEngine(root)
+	if err := engine.EnableWatching(); err != nil {
+		t.Skip("inotify not available:", err)
+	}
+	defer engine.Close()
+
+	sub := engine.current.Children()[1]
+
+	if err := os.WriteFile(filepath.Join(root, "added.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForDir(t, engine, engine.current, func(c []*Node) bool { return hasChild(c, "added.txt") })
+
+	children := engine.current.Children()
+	if len(children) != 3 || filepath.Base(children[0].metadata.Path) != "added.txt" {
+		t.Errorf("new entry not inserted in name order: %d children", len(children))
+	}
+
+	if err := os.Remove(filepath.Join(root, "keep.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitForDir(t, engine, engine.current, func(c []*Node) bool { return !hasChild(c, "keep.txt") })
+
+	// the subdirectory node survives unrelated changes
+	if got := engine.current.Children(); got[len(got)-1] != sub {
+		t.Error("directory node was replaced")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Watcher is only implemented on Linux, elsewhere directories are read once.
+type Watcher struct{}
+
+func NewWatcher() (*Watcher, error) {
+	return nil, errors.New("directory watching is not supported on this platform")
+}
+
+func (w *Watcher) Add(n *Node) error     { return nil }
+func (w *Watcher) Remove(n *Node)        {}
+func (w *Watcher) Changes() <-chan *Node { return nil }
+func (w *Watcher) Close() error          { return nil }
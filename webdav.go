@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// davStatTTL is how long a stat answered by the server, or a name it said
+// is missing, is trusted. Reading a directory always asks again.
+const davStatTTL = 10 * time.Second
+
+// davCallTimeout bounds the requests that are not transfers, reading the
+// answer included. Transfers take as long as they take, only connecting
+// and waiting for the server to answer are bounded by davConnectTimeout.
+const (
+	davCallTimeout    = 30 * time.Second
+	davConnectTimeout = 30 * time.Second
+)
+
+// WebDAVAuth holds the login for a WebDAV server.
+type WebDAVAuth struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// davFS is a WebDAV share. Listings use PROPFIND, transfers GET and PUT.
+// Names are paths on the server below base.
+type davFS struct {
+	client *http.Client
+	base   *url.URL
+	user   string
+	pass   string
+
+	mu    sync.Mutex
+	stats map[string]davStat
+}
+
+// davStat is a cached stat, info is nil for a name known to be missing.
+type davStat struct {
+	info    *davInfo
+	fetched time.Time
+}
+
+// isRemote reports whether location names a WebDAV share.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "webdav://") || strings.HasPrefix(location, "webdavs://")
+}
+
+// OpenWebDAV connects to a webdav:// (or, over TLS, webdavs://) location
+// and returns the share and the path on it to start at. A login in the
+// location wins over one from auth, which is looked up by host.
+func OpenWebDAV(location string, auth map[string]WebDAVAuth) (FS, string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, "", err
+	}
+	switch u.Scheme {
+	case "webdav":
+		u.Scheme = "http"
+	case "webdavs":
+		u.Scheme = "https"
+	default:
+		return nil, "", fmt.Errorf("%s is not a webdav:// location", location)
+	}
+	d := &davFS{
+		client: &http.Client{Transport: davTransport()},
+		stats:  map[string]davStat{},
+	}
+	if a, ok := auth[u.Host]; ok {
+		d.user, d.pass = a.User, a.Password
+	}
+	if u.User != nil {
+		d.user = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			d.pass = pass
+		}
+		u.User = nil
+	}
+	start := path.Clean("/" + u.Path)
+	u.Path, u.RawPath, u.RawQuery, u.Fragment = "", "", "", ""
+	d.base = u
+
+	if _, err := d.Stat(filepath.FromSlash(start)); err != nil {
+		return nil, "", err
+	}
+	return d, filepath.FromSlash(start), nil
+}
+
+// shareOf returns the WebDAV share fsys is, or that the archive fsys
+// is read from lives on, nil for anything else.
+func shareOf(fsys FS) *davFS {
+	for {
+		switch f := fsys.(type) {
+		case *davFS:
+			return f
+		case *archiveFS:
+			fsys = f.outer
+		default:
+			return nil
+		}
+	}
+}
+
+// nodeLocation names n across backends: its path on the local disk, or
+// its webdav:// address when it is on a share. Marks and sort modes are
+// stored under it.
+func nodeLocation(n *Node) string {
+	if share := shareOf(n.FS()); share != nil {
+		return share.String() + filepath.ToSlash(n.metadata.Path)
+	}
+	return n.metadata.Path
+}
+
+// davTransport is the default transport with bounded connecting and
+// waiting, but no deadline on the body.
+func davTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: davConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = davConnectTimeout
+	t.ResponseHeaderTimeout = davConnectTimeout
+	return t
+}
+
+func (d *davFS) String() string {
+	return strings.Replace(d.base.String(), "http", "webdav", 1)
+}
+
+// url is the address of name on the server.
+func (d *davFS) url(name string) string {
+	u := *d.base
+	u.Path = path.Clean("/" + filepath.ToSlash(name))
+	return u.String()
+}
+
+func (d *davFS) do(ctx context.Context, method, name string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if d.user != "" {
+		req.SetBasicAuth(d.user, d.pass)
+	}
+	return d.client.Do(req)
+}
+
+// statusErr turns a failed response into an error for name.
+func statusErr(op, name string, resp *http.Response) error {
+	var err error
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		err = fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = fs.ErrPermission
+	case http.StatusMethodNotAllowed, http.StatusPreconditionFailed:
+		err = fs.ErrExist
+	default:
+		err = fmt.Errorf("webdav: %s", resp.Status)
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+const davPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop>
+<D:resourcetype/><D:getcontentlength/><D:getlastmodified/>
+</D:prop></D:propfind>`
+
+type davMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				Length   int64  `xml:"DAV: getcontentlength"`
+				Modified string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind asks for name itself, or with depth 1 for its entries too, and
+// returns what the server said by path.
+func (d *davFS) propfind(name string, depth int) (map[string]*davInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), davCallTimeout)
+	defer cancel()
+	resp, err := d.do(ctx, "PROPFIND", name, strings.NewReader(davPropfindBody), http.Header{
+		"Depth":        {fmt.Sprint(depth)},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "propfind", Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusErr("propfind", name, resp)
+	}
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, &fs.PathError{Op: "propfind", Path: name, Err: err}
+	}
+
+	infos := map[string]*davInfo{}
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		p := path.Clean("/" + href.Path)
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			info := &davInfo{name: path.Base(p), size: ps.Prop.Length, dir: ps.Prop.ResourceType.Collection != nil}
+			info.modTime, _ = http.ParseTime(ps.Prop.Modified)
+			if info.dir {
+				info.size = 0
+			}
+			infos[filepath.FromSlash(p)] = info
+		}
+	}
+	return infos, nil
+}
+
+// remember caches infos, fetched now.
+func (d *davFS) remember(infos map[string]*davInfo) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, info := range infos {
+		d.stats[name] = davStat{info: info, fetched: now}
+	}
+}
+
+// forget drops what is cached about name and everything below it.
+func (d *davFS) forget(name string) {
+	name = filepath.Clean(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for p := range d.stats {
+		if p == name || strings.HasPrefix(p, name+string(filepath.Separator)) {
+			delete(d.stats, p)
+		}
+	}
+}
+
+func (d *davFS) Lstat(name string) (fs.FileInfo, error) {
+	name = filepath.Clean(name)
+	d.mu.Lock()
+	st, ok := d.stats[name]
+	d.mu.Unlock()
+	if ok && time.Since(st.fetched) < davStatTTL {
+		if st.info == nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+		return st.info, nil
+	}
+
+	infos, err := d.propfind(name, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		d.mu.Lock()
+		d.stats[name] = davStat{fetched: time.Now()}
+		d.mu.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, ok := infos[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: errors.New("webdav: no properties in the answer")}
+	}
+	d.remember(map[string]*davInfo{name: info})
+	return info, nil
+}
+
+// Stat is Lstat, WebDAV has no symlinks.
+func (d *davFS) Stat(name string) (fs.FileInfo, error) { return d.Lstat(name) }
+
+func (d *davFS) Readlink(name string) (string, error) {
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.New("invalid argument")}
+}
+
+func (d *davFS) EvalSymlinks(name string) (string, error) {
+	if _, err := d.Lstat(name); err != nil {
+		return "", err
+	}
+	return filepath.Clean(name), nil
+}
+
+func (d *davFS) Open(name string) (fs.File, error) {
+	name = filepath.Clean(name)
+	info, err := d.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		infos, err := d.propfind(name, 1)
+		if err != nil {
+			return nil, err
+		}
+		d.forget(name)
+		d.remember(infos)
+		var entries []fs.DirEntry
+		for p, child := range infos {
+			if p != name && filepath.Dir(p) == name {
+				entries = append(entries, fs.FileInfoToDirEntry(child))
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		dirInfo := info.(*davInfo)
+		if self, ok := infos[name]; ok {
+			dirInfo = self
+		}
+		return &davDir{info: dirInfo, entries: entries}, nil
+	}
+
+	resp, err := d.do(context.Background(), "GET", name, nil, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusErr("open", name, resp)
+	}
+	return &davFile{ReadCloser: resp.Body, info: info.(*davInfo)}, nil
+}
+
+// Create uploads what is written with a PUT, which finishes on Close.
+func (d *davFS) Create(name string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	w := &davWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := d.do(context.Background(), "PUT", name, pr, nil)
+		if err == nil {
+			if resp.StatusCode/100 != 2 {
+				err = statusErr("put", name, resp)
+			}
+			resp.Body.Close()
+		}
+		pr.CloseWithError(err)
+		d.forget(name)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+func (d *davFS) Mkdir(name string, perm fs.FileMode) error {
+	return d.call("MKCOL", "mkdir", name, nil)
+}
+
+func (d *davFS) RemoveAll(name string) error {
+	err := d.call("DELETE", "remove", name, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *davFS) Rename(oldname, newname string) error {
+	err := d.call("MOVE", "rename", oldname, http.Header{
+		"Destination": {d.url(newname)},
+		"Overwrite":   {"T"},
+	})
+	d.forget(newname)
+	return err
+}
+
+// call sends a request without a body that changes name.
+func (d *davFS) call(method, op, name string, header http.Header) error {
+	defer d.forget(name)
+	ctx, cancel := context.WithTimeout(context.Background(), davCallTimeout)
+	defer cancel()
+	resp, err := d.do(ctx, method, name, nil, header)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusErr(op, name, resp)
+	}
+	return nil
+}
+
+type davInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *davInfo) Name() string       { return i.name }
+func (i *davInfo) Size() int64        { return i.size }
+func (i *davInfo) ModTime() time.Time { return i.modTime }
+func (i *davInfo) IsDir() bool        { return i.dir }
+func (i *davInfo) Sys() any           { return nil }
+func (i *davInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+type davFile struct {
+	io.ReadCloser
+	info *davInfo
+}
+
+func (f *davFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type davDir struct {
+	info    *davInfo
+	entries []fs.DirEntry
+}
+
+func (d *davDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *davDir) Close() error               { return nil }
+func (d *davDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *davDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// davWriter streams into a running PUT.
+type davWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *davWriter) Write(p []byte) (int, error) { return w.pw.Write(p) }
+
+func (w *davWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Download copies n, a file or directory on another backend, into the
+// local directory dir and returns the path it was written to. Nothing
+// existing is overwritten, and a failed download leaves nothing behind.
+func (e *Engine) Download(n *Node, dir string) (string, error) {
+	dest := filepath.Join(dir, filepath.Base(n.metadata.Path))
+	if _, err := os.Lstat(dest); err == nil {
+		return "", &fs.PathError{Op: "download", Path: dest, Err: fs.ErrExist}
+	}
+	if err := copyTree(n.FS(), n.metadata.Path, localFS, dest); err != nil {
+		os.RemoveAll(dest)
+		return "", err
+	}
+	return dest, nil
+}
+
+// Upload copies the local file or directory src into dir and adds it to
+// the tree. Nothing existing is overwritten, and a failed upload is
+// removed again.
+func (e *Engine) Upload(src string, dir *Node) (*Node, error) {
+	name := filepath.Base(src)
+	dest := filepath.Join(dir.metadata.Path, name)
+	if _, err := dir.FS().Lstat(dest); err == nil {
+		return nil, &fs.PathError{Op: "upload", Path: dest, Err: fs.ErrExist}
+	}
+	err := copyTree(localFS, src, dir.FS(), dest)
+	if err != nil {
+		dir.FS().RemoveAll(dest)
+	}
+	if dir.Loaded() {
+		patchChild(dir, name)
+	}
+	invalidateUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+	return nodeAt(dir, name), nil
+}
+
+// defaultDownloadDir is where downloads go: ~/Downloads when there is
+// one, else the home directory.
+func defaultDownloadDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	if info, err := os.Stat(filepath.Join(home, "Downloads")); err == nil && info.IsDir() {
+		return filepath.Join(home, "Downloads")
+	}
+	return home
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// davServer serves fsys over the parts of WebDAV the client uses and
+// counts the PROPFIND requests. Transfers of the name in broken are cut
+// off half way.
+type davServer struct {
+	fsys      *MemFS
+	propfinds int
+	broken    string
+}
+
+func (s *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "ann" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := filepath.FromSlash(path.Clean("/" + r.URL.Path))
+	switch r.Method {
+	case "PROPFIND":
+		s.propfinds++
+		info, err := s.fsys.Stat(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`)
+		writeProp := func(p string, info fs.FileInfo) {
+			kind := ""
+			if info.IsDir() {
+				kind = "<D:collection/>"
+			}
+			fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop>`+
+				`<D:resourcetype>%s</D:resourcetype><D:getcontentlength>%d</D:getcontentlength>`+
+				`<D:getlastmodified>%s</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+				(&url.URL{Path: p}).EscapedPath(), kind, info.Size(), info.ModTime().UTC().Format(http.TimeFormat))
+		}
+		writeProp(r.URL.Path, info)
+		if info.IsDir() && r.Header.Get("Depth") == "1" {
+			entries, _ := readDir(s.fsys, name)
+			for _, e := range entries {
+				child, _ := e.Info()
+				writeProp(path.Join(r.URL.Path, e.Name()), child)
+			}
+		}
+		fmt.Fprint(w, `</D:multistatus>`)
+	case "GET":
+		f, err := s.fsys.Open(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		if path.Base(name) == s.broken {
+			// promise more than is sent, the client sees an unexpected EOF
+			w.Header().Set("Content-Length", "1000")
+			io.CopyN(w, f, 1)
+			return
+		}
+		io.Copy(w, f)
+	case "PUT":
+		f, err := s.fsys.Create(name)
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		io.Copy(f, r.Body)
+		f.Close()
+		if path.Base(name) == s.broken {
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "MKCOL":
+		if err := s.fsys.Mkdir(name, 0755); err != nil {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		if _, err := s.fsys.Lstat(name); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.fsys.RemoveAll(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func startDAV(t *testing.T, files ...string) (*davServer, string) {
+	t.Helper()
+	fsys, _ := makeMemTree(t, files...)
+	s := &davServer{fsys: fsys}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, strings.Replace(srv.URL, "http://", "webdav://", 1)
+}
+
+func TestWebDAV_BrowseAndSearch(t *testing.T) {
+	s, location := startDAV(t, "docs/my notes.txt", "docs/deep/todo.md", "readme")
+	host := strings.TrimPrefix(location, "webdav://")
+
+	if _, _, err := OpenWebDAV(location+"/tree", nil); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("without a login: %v", err)
+	}
+	cfg := &Config{WebDAV: map[string]WebDAVAuth{host: {User: "ann", Password: "secret"}}}
+	engine, err := OpenEngine(location+"/tree", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(engine.current.Children()); got != "docs readme" {
+		t.Fatalf("root children = %q", got)
+	}
+
+	// the listing answers the stats of its entries
+	before := s.propfinds
+	docs := nodeAt(engine.current, "docs")
+	if got := names(docs.Children()); got != "deep my notes.txt" {
+		t.Fatalf("docs children = %q", got)
+	}
+	if s.propfinds-before != 1 {
+		t.Errorf("listing docs took %d PROPFINDs", s.propfinds-before)
+	}
+
+	notes := nodeAt(docs, "my notes.txt")
+	if notes.metadata.Size != int64(len("docs/my notes.txt")) {
+		t.Errorf("size = %d", notes.metadata.Size)
+	}
+	f, err := notes.FS().Open(notes.metadata.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "docs/my notes.txt" {
+		t.Errorf("GET returned %q", data)
+	}
+
+	opts := DefaultSearchOptions()
+	opts.Recursive = true
+	results, err := engine.Search(context.Background(), "todo", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relPaths(results); len(got) != 1 || got[0] != "docs/deep/todo.md" {
+		t.Errorf("search = %v", got)
+	}
+}
+
+func TestWebDAV_Transfers(t *testing.T) {
+	s, location := startDAV(t, "docs/a.txt")
+	engine, err := OpenEngine(strings.Replace(location, "webdav://", "webdav://ann:secret@", 1)+"/tree", &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := nodeAt(engine.current, "docs")
+
+	local := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(local, "up", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(local, "up", "sub", "b.txt"), []byte("uploaded"), 0644)
+	n, err := engine.Upload(filepath.Join(local, "up"), docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == nil || !n.metadata.IsDir {
+		t.Fatalf("uploaded node = %+v", n)
+	}
+	f, err := s.fsys.Open(filepath.Join("/tree", "docs", "up", "sub", "b.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) != "uploaded" {
+		t.Errorf("server has %q", data)
+	}
+	if _, err := engine.Upload(filepath.Join(local, "up"), docs); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("uploading twice: %v", err)
+	}
+
+	dest := t.TempDir()
+	path, err := engine.Download(nodeAt(docs, "a.txt"), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "docs/a.txt" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	if err := engine.Delete(n); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.fsys.Stat(filepath.Join("/tree", "docs", "up")); err == nil {
+		t.Error("deleted directory still on the server")
+	}
+	if got := names(docs.Children()); got != "a.txt" {
+		t.Errorf("docs children = %q", got)
+	}
+}
+
+func TestWebDAV_FailedTransfersLeaveNothing(t *testing.T) {
+	s, location := startDAV(t, "docs/a.txt", "docs/bad.txt")
+	s.broken = "bad.txt"
+	engine, err := OpenEngine(strings.Replace(location, "webdav://", "webdav://ann:secret@", 1)+"/tree", &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := nodeAt(engine.current, "docs")
+
+	dest := t.TempDir()
+	if _, err := engine.Download(docs, dest); err == nil {
+		t.Fatal("download of a cut off file succeeded")
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "docs")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("failed download left %s behind: %v", filepath.Join(dest, "docs"), err)
+	}
+
+	local := t.TempDir()
+	os.MkdirAll(filepath.Join(local, "up"), 0755)
+	os.WriteFile(filepath.Join(local, "up", "bad.txt"), []byte("rejected"), 0644)
+	if _, err := engine.Upload(filepath.Join(local, "up"), docs); err == nil {
+		t.Fatal("upload the server rejected succeeded")
+	}
+	if _, err := s.fsys.Lstat(filepath.Join("/tree", "docs", "up")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("failed upload left the directory on the server: %v", err)
+	}
+	if got := names(docs.Children()); got != "a.txt bad.txt" {
+		t.Errorf("docs children = %q", got)
+	}
+}
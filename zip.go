@@ -0,0 +1,63 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+)
+
+// readZip reads the central directory of the zip file at path. Entries are
+// decompressed when they are opened.
+func readZip(fsys FS, path string) (*archiveEntry, io.Closer, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	var closer io.Closer = f
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		// a zip inside another archive, read it into memory
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		r := bytes.NewReader(data)
+		ra, closer = r, io.NopCloser(r)
+	}
+	zr, err := zip.NewReader(ra, info.Size())
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+
+	root := newArchiveDir(info.ModTime())
+	for _, zf := range zr.File {
+		e := &archiveEntry{
+			mode:    zf.Mode(),
+			size:    int64(zf.UncompressedSize64),
+			packed:  int64(zf.CompressedSize64),
+			modTime: zf.Modified,
+		}
+		switch {
+		case e.mode.IsDir():
+		case e.mode&fs.ModeSymlink != 0:
+			// a link's target is stored as its contents
+			if r, err := zf.Open(); err == nil {
+				target, _ := io.ReadAll(io.LimitReader(r, 4096))
+				r.Close()
+				e.target = string(target)
+			}
+		default:
+			e.open = zf.Open
+		}
+		root.add(zf.Name, e)
+	}
+	return root, closer, nil
+}